@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/likhon22/social/internal/auth"
+	"github.com/likhon22/social/internal/blob"
 	"github.com/likhon22/social/internal/config"
+	"github.com/likhon22/social/internal/mailer"
+	"github.com/likhon22/social/internal/ratelimit"
 	"github.com/likhon22/social/internal/store"
+	"github.com/likhon22/social/internal/stream"
 	"go.uber.org/zap"
 
 	"github.com/likhon22/social/docs" //this is important to generate docs
@@ -16,35 +22,62 @@ import (
 )
 
 type application struct {
-	Config *config.AppConfig
-	store  *store.Storage
-	logger *zap.SugaredLogger
+	Config        *config.AppConfig
+	store         *store.Storage
+	logger        *zap.SugaredLogger
+	mailer        mailer.Client
+	authenticator auth.Authenticator
+	blobs         blob.BlobStore
+	hub           *stream.Hub
+	rateLimits    ratelimit.Store
+	metrics       *appMetrics
 }
 
 func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(app.clientIPMiddleware)
+	r.Use(app.accessLogMiddleware)
+	if app.Config.Metrics.Enabled {
+		r.Use(app.metricsMiddleware)
+	}
 	r.Use(middleware.Recoverer)
+	r.Use(app.rateLimit("global"))
 
 	// Set a timeout value on the request context (ctx), that will signal
 	// through ctx.Done() that the request has timed out and further
-	// processing should be stopped.
-	r.Use(middleware.Timeout(60 * time.Second))
+	// processing should be stopped. The event stream stays open and is left
+	// out.
+	r.Use(middleware.Maybe(middleware.Timeout(60*time.Second), func(r *http.Request) bool {
+		return r.URL.Path != "/v1/stream"
+	}))
 
 	r.Route("/v1", func(r chi.Router) {
 		r.HandleFunc("GET /health", app.healthCheckHandler)
 		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.Config.Addr)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
+		r.Route("/authentication", func(r chi.Router) {
+			r.Use(app.rateLimit("auth"))
+			r.Post("/token", app.createTokenHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+		})
+
 		r.Route("/posts", func(r chi.Router) {
-			r.Post("/", app.createPostHandler)
-			r.Get("/", app.getPostsHandler)
+			r.With(app.AuthTokenMiddleware, app.rateLimit("write")).Post("/", app.createPostHandler)
+			r.With(app.OptionalAuthTokenMiddleware).Get("/", app.getPostsHandler)
 
 			r.Route("/{postId}", func(r chi.Router) {
+				// the viewer is needed to load the post, blocked users do not see it
+				r.Use(app.OptionalAuthTokenMiddleware, app.postsContextMiddleware)
 				r.Get("/", app.getPostByIDHandler)
-				r.Delete("/", app.deletePostByIDHandler)
-				r.Patch("/", app.updatePostHandler)
+				r.Get("/comments", app.getPostCommentsHandler)
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Patch("/", app.checkPostOwnership("", app.updatePostHandler))
+					r.Delete("/", app.checkPostOwnership("moderator", app.deletePostByIDHandler))
+					r.With(app.rateLimit("write")).Put("/reactions", app.reactToPostHandler)
+					r.Delete("/reactions", app.deletePostReactionHandler)
+				})
 			})
 
 		})
@@ -52,31 +85,106 @@ func (app *application) mount() http.Handler {
 		//users
 
 		r.Route("/users", func(r chi.Router) {
-			r.Post("/", app.registerUserHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(app.rateLimit("auth"))
+				r.Post("/", app.registerUserHandler)
+				r.Put("/activate/{token}", app.activateUserHandler)
+				r.Post("/password/forgot", app.forgotPasswordHandler)
+				r.Put("/password/reset/{token}", app.resetPasswordHandler)
+			})
 			r.Get("/", app.getUserHandler)
-			r.Put("/activate/{token}", app.activateUserHandler)
 			r.Route("/{userId}", func(r chi.Router) {
 				r.Use(app.UserIdContextMiddleware)
 				r.Get("/", app.getUserByIdHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unFollowUserHandler)
+				r.With(app.OptionalAuthTokenMiddleware).Get("/comments", app.getUserCommentsHandler)
+				r.With(app.OptionalAuthTokenMiddleware).Get("/followers", app.getFollowersHandler)
+				r.With(app.OptionalAuthTokenMiddleware).Get("/following", app.getFollowingHandler)
+				r.With(app.AuthTokenMiddleware, app.rateLimit("write")).Put("/follow", app.followUserHandler)
+				r.With(app.AuthTokenMiddleware).Put("/unfollow", app.unFollowUserHandler)
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Put("/block", app.blockUserHandler)
+					r.Delete("/block", app.unblockUserHandler)
+					r.Put("/mute", app.muteUserHandler)
+					r.Delete("/mute", app.unmuteUserHandler)
+					r.Put("/follow-request/approve", app.approveFollowRequestHandler)
+					r.Put("/follow-request/reject", app.rejectFollowRequestHandler)
+				})
 			})
 
 			r.Get("/email", app.getUserByEmailHandler)
 
 			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
 				r.Get("/feed", app.getUserFeedHandler)
+				r.Get("/follow-requests", app.getFollowRequestsHandler)
+				r.Put("/privacy", app.updatePrivacyHandler)
 			})
 
 		})
+		r.With(app.OptionalAuthTokenMiddleware).Get("/search", app.searchHandler)
+
+		r.With(app.StreamAuthMiddleware).Get("/stream", app.streamHandler)
+		r.With(app.AuthTokenMiddleware).Post("/stream/token", app.createStreamTokenHandler)
+
+		r.Route("/notifications", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/", app.getNotificationsHandler)
+			r.Get("/unread-count", app.getUnreadCountHandler)
+			r.Put("/read", app.markNotificationsReadHandler)
+		})
+
+		r.Route("/tags", func(r chi.Router) {
+			r.Get("/trending", app.getTrendingTagsHandler)
+			r.With(app.OptionalAuthTokenMiddleware).Get("/{tag}/posts", app.getTagPostsHandler)
+		})
+
+		r.Route("/media", func(r chi.Router) {
+			r.With(app.AuthTokenMiddleware, app.rateLimit("write")).Post("/", app.uploadMediaHandler)
+			// the local blob store serves its own signed URLs
+			if local, ok := app.blobs.(*blob.LocalStore); ok {
+				r.Handle("/files/*", http.StripPrefix("/v1/media/files", local))
+			}
+		})
+
 		//comment
 		r.Route("/comments", func(r chi.Router) {
-			r.Post("/", app.CreateCommentHandler)
+			r.With(app.AuthTokenMiddleware, app.rateLimit("write")).Post("/", app.CreateCommentHandler)
+			r.Route("/{commentId}", func(r chi.Router) {
+				r.Use(app.OptionalAuthTokenMiddleware)
+				// the replies of deleted comments stay readable below their placeholder
+				r.With(app.commentsContextMiddleware(true)).Get("/replies", app.getCommentRepliesHandler)
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.With(app.commentsContextMiddleware(true)).Get("/history", app.checkCommentOwnership("moderator", app.getCommentHistoryHandler))
+					r.Group(func(r chi.Router) {
+						r.Use(app.commentsContextMiddleware(false))
+						r.Patch("/", app.checkCommentOwnership("", app.updateCommentHandler))
+						r.Delete("/", app.checkCommentOwnership("moderator", app.deleteCommentHandler))
+						r.With(app.rateLimit("write")).Put("/reactions", app.reactToCommentHandler)
+						r.Delete("/reactions", app.deleteCommentReactionHandler)
+					})
+				})
+			})
 		})
 	})
 	return r
 }
-func (app *application) serve(mux http.Handler) error {
+
+// mountAdmin returns the handler of the admin server, which only serves the
+// metrics.
+func (app *application) mountAdmin() http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Method(http.MethodGet, "/metrics", app.metrics.registry.Handler())
+	return r
+}
+
+// serve serves mux, and the admin server when metrics are enabled, until ctx
+// is done or a server fails. It then shuts the servers down gracefully: they
+// stop accepting connections and wait, up to the shutdown timeout, for
+// in-flight requests and streams to finish.
+func (app *application) serve(ctx context.Context, mux http.Handler) error {
 
 	docs.SwaggerInfo.Version = app.Config.Version
 	docs.SwaggerInfo.Host = app.Config.ApiURL
@@ -89,6 +197,42 @@ func (app *application) serve(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
-	app.logger.Infow("server has started", "addr", app.Config.Addr)
-	return srv.ListenAndServe()
+	// streams never finish on their own, they are ended as shutdown starts
+	srv.RegisterOnShutdown(app.hub.Close)
+	servers := []*http.Server{srv}
+	if app.Config.Metrics.Enabled {
+		servers = append(servers, &http.Server{
+			Addr:         app.Config.Metrics.Addr,
+			Handler:      app.mountAdmin(),
+			WriteTimeout: time.Second * 10,
+			ReadTimeout:  time.Second * 10,
+		})
+	}
+
+	serveErr := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			app.logger.Infow("server has started", "addr", srv.Addr)
+			serveErr <- srv.ListenAndServe()
+		}()
+	}
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+	}
+
+	app.logger.Infow("shutting down server", "timeout", app.Config.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), app.Config.ShutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(shutdownCtx); err == nil {
+			err = shutdownErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// the server does not wait for WebSocket connections, it handed them over
+	return app.hub.Wait(shutdownCtx)
 }
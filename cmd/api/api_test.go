@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/likhon22/social/internal/config"
+	"github.com/likhon22/social/internal/stream"
+	"go.uber.org/zap"
+)
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// startServe serves h with the shutdown timeout until the returned cancel is
+// called, and returns the address and what serve returned.
+func startServe(t *testing.T, h http.Handler, timeout time.Duration) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	app := &application{
+		Config: &config.AppConfig{
+			Addr:            freeAddr(t),
+			ShutdownTimeout: timeout,
+			Metrics:         &config.MetricsConfig{},
+		},
+		logger: zap.NewNop().Sugar(),
+		hub:    stream.NewHub(nil, zap.NewNop().Sugar()),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- app.serve(ctx, h) }()
+
+	// wait for the server to listen
+	for range 100 {
+		conn, err := net.Dial("tcp", app.Config.Addr)
+		if err == nil {
+			conn.Close()
+			return app.Config.Addr, cancel, served
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	t.Fatal("the server did not start")
+	return "", nil, nil
+}
+
+func TestServeDrainsRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	addr, cancel, served := startServe(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	}), 5*time.Second)
+
+	answered := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + addr)
+		if err != nil {
+			answered <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		answered <- string(body)
+	}()
+	<-started
+	cancel()
+
+	// the server stops taking connections, but waits for the request
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-served:
+		t.Fatalf("serve returned %v with a request in flight", err)
+	default:
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("the server took a connection while shutting down")
+	}
+
+	close(release)
+	if body := <-answered; body != "done" {
+		t.Errorf("the request in flight got %q", body)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve returned %v", err)
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	addr, cancel, served := startServe(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}), 50*time.Millisecond)
+
+	go http.Get("http://" + addr)
+	<-started
+	cancel()
+	select {
+	case err := <-served:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("serve returned %v, want the shutdown timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not give up after the shutdown timeout")
+	}
+}
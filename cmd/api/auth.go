@@ -3,20 +3,38 @@ package main
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/likhon22/social/internal/jobs"
+	"github.com/likhon22/social/internal/mailer"
 	"github.com/likhon22/social/internal/store"
 )
 
 type RegisterUserPayload struct {
-	Username string `json:"username" db:"username" validator:"required,max=100"`
-	Password string `json:"password" db:"password" validator:"required,min=5,max=200"`
-	Email    string `json:"email" db:"email" validator:"required,email,max=50"`
+	Username string `json:"username" db:"username" validate:"required,max=100"`
+	Password string `json:"password" db:"password" validate:"required,min=5,max=72"`
+	Email    string `json:"email" db:"email" validate:"required,email,max=50"`
 }
 
+// dummyPassword is compared with the password of unknown emails, so that they
+// take as long to turn down as a wrong password.
+var dummyPassword = sync.OnceValue(func() *store.Password {
+	var p store.Password
+	if err := p.Set("not the password of any user"); err != nil {
+		panic(err)
+	}
+	return &p
+})
+
 // @Summary		Register a new user
-// @Description	Registers a new user in the system
+// @Description	Registers a new user in the system and emails them an activation link
 // @Tags			Users
 // @Accept			json
 // @Produce		json
@@ -29,9 +47,11 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	var payload RegisterUserPayload
 	if err := readJSON(w, r, &payload); err != nil {
 		app.BadRequestError(w, r, err)
+		return
 	}
 	if err := Validate.Struct(payload); err != nil {
 		app.BadRequestError(w, r, err)
+		return
 	}
 
 	user := &store.User{
@@ -45,16 +65,164 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 	ctx := r.Context()
 	plainToken := uuid.New().String()
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
-	if err := app.store.Users.CreateAndInvite(ctx, user, hashToken, app.Config.Mail.Exp); err != nil {
-		app.StatusInternalServerError(w, r, err)
-	}
 
 	// mail
+	invitation, err := jobs.NewEmailMessage(jobs.EmailPayload{
+		Template: mailer.UserWelcomeTemplate,
+		Username: user.Username,
+		Email:    user.Email,
+		Data: map[string]any{
+			"Username":      user.Username,
+			"ActivationURL": fmt.Sprintf("%s/confirm/%s", app.Config.FrontendURL, plainToken),
+		},
+		IsSandbox: app.Config.Env != "production",
+	})
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Users.CreateAndInvite(ctx, user, hashToken(plainToken), app.Config.Mail.Exp, invitation); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	app.metrics.registrations.Inc()
 
 	if err := writeJSON(w, http.StatusCreated, user); err != nil {
 		app.StatusInternalServerError(w, r, err)
 	}
 
 }
+
+type CreateUserTokenPayload struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// @Summary		Create a token
+// @Description	Exchanges user credentials for an access and a refresh token
+// @Tags			Authentication
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		CreateUserTokenPayload	true	"User credentials"
+// @Success		201		{object}	TokenResponse			"Tokens"
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		500		{object}	error
+// @Router			/authentication/token [post]
+func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateUserTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	user, err := app.store.Users.GetUserByEmail(ctx, payload.Email)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	// same answer for an unknown email and a wrong password, in the same time
+	if user == nil {
+		_ = dummyPassword().Compare(payload.Password)
+		app.UnauthorizedError(w, r, errors.New("invalid credentials"))
+		return
+	}
+	if user.Password.Compare(payload.Password) != nil {
+		app.UnauthorizedError(w, r, errors.New("invalid credentials"))
+		return
+	}
+	if !user.IsActive {
+		app.UnauthorizedError(w, r, errors.New("user is not activated"))
+		return
+	}
+	session := &store.Session{UserID: user.ID}
+	refreshToken := app.newSessionToken(session)
+	if err := app.store.Sessions.Create(ctx, session); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	app.writeTokens(w, r, user.ID, refreshToken)
+}
+
+// @Summary		Refresh a token
+// @Description	Exchanges a refresh token for a new access and refresh token, the old refresh token can not be used again
+// @Tags			Authentication
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		RefreshTokenPayload	true	"Refresh token"
+// @Success		201		{object}	TokenResponse		"Tokens"
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		500		{object}	error
+// @Router			/authentication/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	session := &store.Session{}
+	refreshToken := app.newSessionToken(session)
+	err := app.store.Sessions.Rotate(r.Context(), hashToken(payload.RefreshToken), session)
+	if err != nil {
+		if errors.Is(err, store.ErrSessionNotFound) {
+			app.UnauthorizedError(w, r, err)
+			return
+		}
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	app.writeTokens(w, r, session.UserID, refreshToken)
+}
+
+// newSessionToken fills in the hashed token and expiry of session and returns
+// the plain refresh token that is handed to the client.
+func (app *application) newSessionToken(session *store.Session) string {
+	plainToken := uuid.New().String()
+	session.Token = hashToken(plainToken)
+	session.Expiry = time.Now().Add(app.Config.Auth.Token.RefreshExp)
+	return plainToken
+}
+
+func (app *application) writeTokens(w http.ResponseWriter, r *http.Request, userID int64, refreshToken string) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": strconv.FormatInt(userID, 10),
+		"exp": now.Add(app.Config.Auth.Token.Exp).Unix(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"iss": app.Config.Auth.Token.Iss,
+		"aud": app.Config.Auth.Token.Iss,
+	}
+	accessToken, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	res := TokenResponse{AccessToken: accessToken, RefreshToken: refreshToken}
+	if err := writeJSON(w, http.StatusCreated, res); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+func hashToken(plainToken string) string {
+	hash := sha256.Sum256([]byte(plainToken))
+	return hex.EncodeToString(hash[:])
+}
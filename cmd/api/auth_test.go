@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/likhon22/social/internal/store"
+)
+
+// knownUsers finds the one user of alice@example.com.
+type knownUsers struct {
+	store.Users
+	alice *store.User
+}
+
+func (u knownUsers) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	if email == u.alice.Email {
+		return u.alice, nil
+	}
+	return nil, nil
+}
+
+// TestCreateTokenUnknownEmail checks an unknown email is turned down like a
+// wrong password, and only after comparing a password.
+func TestCreateTokenUnknownEmail(t *testing.T) {
+	alice := &store.User{ID: 1, Email: "alice@example.com", IsActive: true}
+	if err := alice.Password.Set("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	app := newAuthApp()
+	app.store.Users = knownUsers{alice: alice}
+	dummyPassword()
+
+	signIn := func(body string) (*httptest.ResponseRecorder, time.Duration) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/authentication/token", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		app.createTokenHandler(rec, req)
+		return rec, time.Since(start)
+	}
+	wrong, wrongTook := signIn(`{"email":"alice@example.com","password":"battery staple"}`)
+	unknown, unknownTook := signIn(`{"email":"bob@example.com","password":"battery staple"}`)
+
+	if wrong.Code != http.StatusUnauthorized || unknown.Code != http.StatusUnauthorized {
+		t.Fatalf("got statuses %d and %d, want 401", wrong.Code, unknown.Code)
+	}
+	if wrong.Body.String() != unknown.Body.String() {
+		t.Errorf("wrong password: %s, unknown email: %s", wrong.Body, unknown.Body)
+	}
+	// a bcrypt comparison takes tens of milliseconds, a lookup alone microseconds
+	if unknownTook < wrongTook/4 {
+		t.Errorf("unknown email took %v, wrong password %v", unknownTook, wrongTook)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// @Summary		Block a user
+// @Description	Blocks a user. Blocked users cannot follow, comment on or see the posts of the blocker, and the follows between the two users are removed
+// @Tags			Users
+// @Produce		json
+// @Param			userId	path		int		true	"User ID to block"
+// @Success		200		{string}	string	"user blocked"
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/users/{userId}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.applyToTargetUser(w, r, "you can not block yourself", app.store.Blocks.Block, "user blocked")
+}
+
+// @Summary		Unblock a user
+// @Description	Removes the block on a user
+// @Tags			Users
+// @Produce		json
+// @Param			userId	path		int		true	"User ID to unblock"
+// @Success		200		{string}	string	"user unblocked"
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/users/{userId}/block [delete]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.applyToTargetUser(w, r, "you can not unblock yourself", app.store.Blocks.Unblock, "user unblocked")
+}
+
+// @Summary		Mute a user
+// @Description	Hides the posts of a user from the feed of the authenticated user
+// @Tags			Users
+// @Produce		json
+// @Param			userId	path		int		true	"User ID to mute"
+// @Success		200		{string}	string	"user muted"
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/users/{userId}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.applyToTargetUser(w, r, "you can not mute yourself", app.store.Blocks.Mute, "user muted")
+}
+
+// @Summary		Unmute a user
+// @Description	Shows the posts of a muted user in the feed again
+// @Tags			Users
+// @Produce		json
+// @Param			userId	path		int		true	"User ID to unmute"
+// @Success		200		{string}	string	"user unmuted"
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/users/{userId}/mute [delete]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.applyToTargetUser(w, r, "you can not unmute yourself", app.store.Blocks.Unmute, "user unmuted")
+}
+
+// applyToTargetUser runs action with the authenticated user and the user of the
+// {userId} path param.
+func (app *application) applyToTargetUser(w http.ResponseWriter, r *http.Request, selfErr string, action func(context.Context, int64, int64) error, done string) {
+	target := getUserFromContext(r)
+	user := getAuthUserFromContext(r)
+	if target.ID == user.ID {
+		app.BadRequestError(w, r, errors.New(selfErr))
+		return
+	}
+	if err := action(r.Context(), user.ID, target.ID); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, done)
+}
@@ -1,15 +1,29 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/likhon22/social/internal/store"
 )
 
+const (
+	defaultThreadDepth   = 3
+	maxThreadDepth       = 5
+	defaultThreadReplies = 3
+	maxThreadReplies     = 20
+)
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
 type CreateCommentPayload struct {
-	PostID  int64  `json:"post_id" db:"post_id" validate:"required"`
-	UserID  int64  `json:"user_id" db:"user_id" validate:"required"`
-	Content string `json:"content" db:"content" validate:"required,max=1000"`
+	PostID   int64  `json:"post_id" db:"post_id" validate:"required"`
+	ParentID *int64 `json:"parent_id" db:"parent_id" validate:"omitempty,gte=1"`
+	Content  string `json:"content" db:"content" validate:"required,max=1000"`
 }
 
 func (app *application) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -19,19 +33,254 @@ func (app *application) CreateCommentHandler(w http.ResponseWriter, r *http.Requ
 		app.StatusInternalServerError(w, r, err)
 		return
 	}
-	Validate.Struct(commentPayload)
+	if err := Validate.Struct(commentPayload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
 	comment := &store.Comment{
-		PostID:  int(commentPayload.PostID),
-		UserID:  int(commentPayload.UserID),
-		Content: commentPayload.Content,
+		PostID:   int(commentPayload.PostID),
+		UserID:   int(getAuthUserFromContext(r).ID),
+		ParentID: commentPayload.ParentID,
+		Content:  commentPayload.Content,
 	}
 
 	if err := app.store.Comments.CreateComment(r.Context(), comment); err != nil {
+		if errors.Is(err, store.ErrInvalidParentComment) {
+			app.BadRequestError(w, r, err)
+			return
+		}
+		if errors.Is(err, store.ErrPostNotVisible) {
+			app.ForbiddenError(w, r, err)
+			return
+		}
 		app.StatusInternalServerError(w, r, err)
 		return
 	}
+	app.metrics.comments.Inc()
 	if err := writeJSON(w, http.StatusOK, comment); err != nil {
 		app.StatusInternalServerError(w, r, err)
 	}
 
 }
+
+// @Summary		Get the comments of a post
+// @Description	Retrieves a page of top-level comments of a post, newest first by default, each with its first replies nested
+// @Tags			Comments
+// @Produce		json
+// @Param			postId	path		int		true	"Post ID"
+// @Param			limit	query		int		false	"Page size"
+// @Param			page	query		int		false	"Page number, ignored when cursor is set"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Param			sort	query		string	false	"asc or desc"
+// @Param			depth	query		int		false	"Levels of the tree to load, 1 to 5"
+// @Param			replies	query		int		false	"Replies loaded per comment on each level, 1 to 20"
+// @Success		200		{object}	store.PaginatedResponse[store.Comment]
+// @Failure		400		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Router			/posts/{postId}/comments [get]
+func (app *application) getPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+	fq, err := parsePaginatedQuery(r, 20)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	opts, err := parseThreadOptions(r)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	comments, err := app.store.Comments.GetCommentsWithPost(r.Context(), post.ID, fq, opts)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	app.writeComments(w, r, fq, *comments)
+}
+
+// @Summary		Get the replies of a comment
+// @Description	Retrieves a page of direct replies of a comment, oldest first by default, each with its first replies nested
+// @Tags			Comments
+// @Produce		json
+// @Param			commentId	path		int		true	"Comment ID"
+// @Param			limit		query		int		false	"Page size"
+// @Param			cursor		query		string	false	"next_cursor of the previous page, or replies_next_cursor of the comment"
+// @Param			sort		query		string	false	"asc or desc"
+// @Param			depth		query		int		false	"Levels of the tree to load, 1 to 5"
+// @Param			replies		query		int		false	"Replies loaded per comment on each level, 1 to 20"
+// @Success		200			{object}	store.PaginatedResponse[store.Comment]
+// @Failure		400			{object}	error
+// @Failure		404			{object}	error
+// @Failure		500			{object}	error
+// @Router			/comments/{commentId}/replies [get]
+func (app *application) getCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+	fq := store.PaginatedFeedQuery{Page: 1, Limit: 20, Sort: "asc", Match: "any"}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(fq); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	opts, err := parseThreadOptions(r)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	replies, err := app.store.Comments.GetReplies(r.Context(), int64(comment.ID), fq, opts)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	app.writeComments(w, r, fq, *replies)
+}
+
+func (app *application) writeComments(w http.ResponseWriter, r *http.Request, fq store.PaginatedFeedQuery, comments []store.Comment) {
+	res := store.NewPaginatedResponse(fq, comments, func(c store.Comment) store.Cursor {
+		return store.Cursor{CreatedAt: c.CreatedAt, ID: int64(c.ID)}
+	})
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+func parseThreadOptions(r *http.Request) (store.ThreadOptions, error) {
+	opts := store.ThreadOptions{Depth: defaultThreadDepth, Replies: defaultThreadReplies}
+	qs := r.URL.Query()
+	if depth := qs.Get("depth"); depth != "" {
+		d, err := strconv.Atoi(depth)
+		if err != nil || d < 1 || d > maxThreadDepth {
+			return opts, fmt.Errorf("depth must be between 1 and %d", maxThreadDepth)
+		}
+		opts.Depth = d
+	}
+	if replies := qs.Get("replies"); replies != "" {
+		n, err := strconv.Atoi(replies)
+		if err != nil || n < 1 || n > maxThreadReplies {
+			return opts, fmt.Errorf("replies must be between 1 and %d", maxThreadReplies)
+		}
+		opts.Replies = n
+	}
+	return opts, nil
+}
+
+// @Summary		Edit a comment
+// @Description	Changes the content of a comment, the previous content is kept in its history
+// @Tags			Comments
+// @Accept			json
+// @Produce		json
+// @Param			commentId	path		int						true	"Comment ID"
+// @Param			payload		body		UpdateCommentPayload	true	"New content"
+// @Success		200			{object}	store.Comment
+// @Failure		400			{object}	error
+// @Failure		401			{object}	error
+// @Failure		403			{object}	error
+// @Failure		404			{object}	error
+// @Failure		500			{object}	error
+// @Security		ApiKeyAuth
+// @Router			/comments/{commentId} [patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	updated, err := app.store.Comments.Update(r.Context(), int64(comment.ID), payload.Content, getAuthUserFromContext(r).ID)
+	if err != nil {
+		if errors.Is(err, store.ErrCommentNotFound) {
+			app.NotFoundError(w, r, err)
+			return
+		}
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := writeJSON(w, http.StatusOK, updated); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+// @Summary		Delete a comment
+// @Description	Soft deletes a comment, its replies stay visible
+// @Tags			Comments
+// @Param			commentId	path	int	true	"Comment ID"
+// @Success		204
+// @Failure		401	{object}	error
+// @Failure		403	{object}	error
+// @Failure		404	{object}	error
+// @Failure		500	{object}	error
+// @Security		ApiKeyAuth
+// @Router			/comments/{commentId} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+	if err := app.store.Comments.Delete(r.Context(), int64(comment.ID)); err != nil {
+		if errors.Is(err, store.ErrCommentNotFound) {
+			app.NotFoundError(w, r, err)
+			return
+		}
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Get the edit history of a comment
+// @Description	Retrieves the previous versions of a comment, oldest first. Only for the author and moderators
+// @Tags			Comments
+// @Produce		json
+// @Param			commentId	path		int	true	"Comment ID"
+// @Success		200			{array}		store.CommentEdit
+// @Failure		401			{object}	error
+// @Failure		403			{object}	error
+// @Failure		404			{object}	error
+// @Failure		500			{object}	error
+// @Security		ApiKeyAuth
+// @Router			/comments/{commentId}/history [get]
+func (app *application) getCommentHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+	edits, err := app.store.Comments.GetEdits(r.Context(), int64(comment.ID))
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := writeJSON(w, http.StatusOK, edits); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+// @Summary		Get the comments of a user
+// @Description	Retrieves a page of the comments a user wrote, newest first by default
+// @Tags			Comments
+// @Produce		json
+// @Param			userId	path		int		true	"User ID"
+// @Param			limit	query		int		false	"Page size"
+// @Param			page	query		int		false	"Page number, ignored when cursor is set"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Param			sort	query		string	false	"asc or desc"
+// @Success		200		{object}	store.PaginatedResponse[store.Comment]
+// @Failure		400		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Router			/users/{userId}/comments [get]
+func (app *application) getUserCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	fq, err := parsePaginatedQuery(r, 20)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	comments, err := app.store.Comments.GetByUser(r.Context(), user.ID, getViewerID(r), fq)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	app.writeComments(w, r, fq, *comments)
+}
@@ -1,13 +1,26 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 func (app *application) StatusInternalServerError(w http.ResponseWriter, r *http.Request, err error) {
 
-	app.logger.Errorw("internal server ", "error", err.Error(), "method", r.Method, "URL", r.URL.Path)
-	writeJSONError(w, http.StatusInternalServerError, "something happen on the server")
+	app.requestLogger(r).Errorw("internal server ", "error", err.Error(), "method", r.Method, "URL", r.URL.Path)
+	// the request ID lets support find the log line of the error
+	type envelope struct {
+		Error     string `json:"error"`
+		Success   bool   `json:"success"`
+		RequestID string `json:"request_id,omitempty"`
+	}
+	writeJSON(w, http.StatusInternalServerError, &envelope{
+		Error:     "something happen on the server",
+		RequestID: middleware.GetReqID(r.Context()),
+	})
 }
 func (app *application) BadRequestError(w http.ResponseWriter, r *http.Request, err error) {
 	var msg string
@@ -17,7 +30,7 @@ func (app *application) BadRequestError(w http.ResponseWriter, r *http.Request,
 		msg = "bad request"
 	}
 
-	app.logger.Errorw("bad request", "error", err.Error(), "method", r.Method, "URL", r.URL.Path)
+	app.requestLogger(r).Errorw("bad request", "error", msg, "method", r.Method, "URL", r.URL.Path)
 	writeJSONError(w, http.StatusBadRequest, msg)
 }
 func (app *application) NotFoundError(w http.ResponseWriter, r *http.Request, err error) {
@@ -28,6 +41,19 @@ func (app *application) NotFoundError(w http.ResponseWriter, r *http.Request, er
 		msg = "not found"
 	}
 
-	app.logger.Errorw("not found", "error", msg, "method", r.Method, "URL", r.URL.Path)
+	app.requestLogger(r).Errorw("not found", "error", msg, "method", r.Method, "URL", r.URL.Path)
 	writeJSONError(w, http.StatusNotFound, "not found")
 }
+func (app *application) UnauthorizedError(w http.ResponseWriter, r *http.Request, err error) {
+	app.requestLogger(r).Warnw("unauthorized", "error", err.Error(), "method", r.Method, "URL", r.URL.Path)
+	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+}
+func (app *application) ForbiddenError(w http.ResponseWriter, r *http.Request, err error) {
+	app.requestLogger(r).Warnw("forbidden", "error", err.Error(), "method", r.Method, "URL", r.URL.Path)
+	writeJSONError(w, http.StatusForbidden, "forbidden")
+}
+func (app *application) rateLimitExceededError(w http.ResponseWriter, r *http.Request, policy string, retryAfter int) {
+	app.requestLogger(r).Warnw("rate limit exceeded", "policy", policy, "remote", r.RemoteAddr, "method", r.Method, "URL", r.URL.Path)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded, retry in %d seconds", retryAfter))
+}
@@ -6,27 +6,66 @@ import (
 	"github.com/likhon22/social/internal/store"
 )
 
+// @Summary		Get the user feed
+// @Description	Retrieves posts of the authenticated user and of the users they follow
+// @Tags			Feed
+// @Produce		json
+// @Param			limit	query		int		false	"Page size"
+// @Param			page	query		int		false	"Page number, ignored when cursor is set"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Param			sort	query		string	false	"asc or desc"
+// @Param			search	query		string	false	"Search in title and content"
+// @Param			tags	query		string	false	"Comma separated tags"
+// @Param			match	query		string	false	"any (default) or all of the tags"
+// @Param			since	query		string	false	"Only posts created at or after, 2006-01-02T15:04:05Z"
+// @Param			until	query		string	false	"Only posts created at or before, 2006-01-02T15:04:05Z"
+// @Success		200		{object}	store.PaginatedResponse[store.PostWithMetaData]
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
 	//pagination,filters
+	fq, err := parsePaginatedQuery(r, 3)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	feed, err := app.store.Posts.GetUserFeed(r.Context(), getAuthUserFromContext(r).ID, fq)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	for i := range *feed {
+		if err := app.signAttachments(r.Context(), &(*feed)[i].Post); err != nil {
+			app.StatusInternalServerError(w, r, err)
+			return
+		}
+	}
+	res := store.NewPaginatedResponse(fq, *feed, func(p store.PostWithMetaData) store.Cursor {
+		return store.Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+	})
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+// parsePaginatedQuery reads the pagination and filter query params on top of
+// the defaults, and validates the result.
+func parsePaginatedQuery(r *http.Request, limit int) (store.PaginatedFeedQuery, error) {
 	fq := store.PaginatedFeedQuery{
 		Page:  1,
-		Limit: 3,
+		Limit: limit,
 		Sort:  "desc",
+		Match: "any",
 	}
 	fq, err := fq.Parse(r)
-
 	if err != nil {
-		app.BadRequestError(w, r, err)
-
+		return fq, err
 	}
 	if err := Validate.Struct(fq); err != nil {
-		app.BadRequestError(w, r, err)
-	}
-	feed, err := app.store.Posts.GetUserFeed(r.Context(), int64(42), fq)
-	if err != nil {
-		app.StatusInternalServerError(w, r, err)
-	}
-	if err := writeJSON(w, http.StatusOK, feed); err != nil {
-		app.StatusInternalServerError(w, r, err)
+		return fq, err
 	}
+	return fq, nil
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/likhon22/social/internal/store"
+)
+
+type UpdatePrivacyPayload struct {
+	IsPrivate *bool `json:"is_private" validate:"required"`
+}
+
+// @Summary		Change the privacy of the account
+// @Description	Makes the account of the authenticated user private or public. The posts of a private account are only shown to its approved followers, making it public approves the pending follow requests
+// @Tags			Users
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		UpdatePrivacyPayload	true	"Privacy setting"
+// @Success		200		{object}	store.User
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/users/privacy [put]
+func (app *application) updatePrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdatePrivacyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	user := getAuthUserFromContext(r)
+	if _, err := app.store.Users.SetPrivate(r.Context(), user.ID, *payload.IsPrivate); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	user.IsPrivate = *payload.IsPrivate
+	if err := writeJSON(w, http.StatusOK, user); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+// @Summary		Get the pending follow requests
+// @Description	Retrieves a page of the follow requests sent to the authenticated user, most recent first by default
+// @Tags			Users
+// @Produce		json
+// @Param			limit	query		int		false	"Page size"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Param			sort	query		string	false	"asc or desc"
+// @Success		200		{object}	store.PaginatedResponse[store.FollowUser]
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/users/follow-requests [get]
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := parsePaginatedQuery(r, 20)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	users, err := app.store.Followers.GetRequests(r.Context(), getAuthUserFromContext(r).ID, fq)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	res := store.NewPaginatedResponse(fq, users, func(u store.FollowUser) store.Cursor {
+		return store.Cursor{CreatedAt: u.FollowedAt, ID: u.ID}
+	})
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+// @Summary		Approve a follow request
+// @Description	Lets the user who sent the follow request follow the authenticated user
+// @Tags			Users
+// @Produce		json
+// @Param			userId	path		int		true	"User ID of the requester"
+// @Success		200		{string}	string	"follow request approved"
+// @Failure		401		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/users/{userId}/follow-request/approve [put]
+func (app *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.store.Followers.ApproveRequest(r.Context(), getAuthUserFromContext(r).ID, getUserFromContext(r).ID)
+	app.writeFollowRequestResult(w, r, err, "follow request approved")
+}
+
+// @Summary		Reject a follow request
+// @Description	Deletes the follow request the user sent to the authenticated user
+// @Tags			Users
+// @Produce		json
+// @Param			userId	path		int		true	"User ID of the requester"
+// @Success		200		{string}	string	"follow request rejected"
+// @Failure		401		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/users/{userId}/follow-request/reject [put]
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.store.Followers.RejectRequest(r.Context(), getAuthUserFromContext(r).ID, getUserFromContext(r).ID)
+	app.writeFollowRequestResult(w, r, err, "follow request rejected")
+}
+
+func (app *application) writeFollowRequestResult(w http.ResponseWriter, r *http.Request, err error, done string) {
+	if err != nil {
+		if errors.Is(err, store.ErrFollowRequestNotFound) {
+			app.NotFoundError(w, r, err)
+			return
+		}
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, done)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/likhon22/social/internal/stream"
+	"go.uber.org/zap"
+)
+
+const requestLogKey contextKey = "requestLog"
+
+// requestLog is the logger of a request. It is shared by pointer so that the
+// user, known only once the auth middleware ran, reaches the access log too.
+type requestLog struct {
+	logger *zap.SugaredLogger
+	userID int64
+}
+
+// accessLogMiddleware puts a logger tagged with the request ID on the request
+// context and logs every request once it is served. It replaces
+// middleware.Logger, so access and error lines share their fields.
+func (app *application) accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		reqLog := &requestLog{logger: app.logger.With("request_id", middleware.GetReqID(r.Context()))}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogKey, reqLog))
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			status := responseStatus(r, ww)
+			fields := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", chi.RouteContext(r.Context()).RoutePattern(),
+				"status", status,
+				"bytes", ww.BytesWritten(),
+				"latency", time.Since(start).String(),
+				"remote", r.RemoteAddr,
+			}
+			switch {
+			case status >= http.StatusInternalServerError:
+				reqLog.logger.Errorw("request", fields...)
+			case status >= http.StatusBadRequest:
+				reqLog.logger.Warnw("request", fields...)
+			default:
+				reqLog.logger.Infow("request", fields...)
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// requestLogger is the logger of the request, tagged with its request ID and,
+// once authenticated, its user ID.
+func (app *application) requestLogger(r *http.Request) *zap.SugaredLogger {
+	if reqLog, ok := r.Context().Value(requestLogKey).(*requestLog); ok {
+		return reqLog.logger
+	}
+	return app.logger
+}
+
+// setRequestUser tags the logger of the request with the authenticated user.
+func setRequestUser(r *http.Request, userID int64) {
+	if reqLog, ok := r.Context().Value(requestLogKey).(*requestLog); ok && reqLog.userID == 0 {
+		reqLog.userID = userID
+		reqLog.logger = reqLog.logger.With("user_id", userID)
+	}
+}
+
+// responseStatus is the status code a request was answered with.
+func responseStatus(r *http.Request, ww middleware.WrapResponseWriter) int {
+	status := ww.Status()
+	if status == 0 {
+		// nothing was written, or the connection was taken over
+		status = http.StatusOK
+		if stream.IsWebSocket(r) {
+			status = http.StatusSwitchingProtocols
+		}
+	}
+	return status
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	app := &application{logger: zap.New(core).Sugar()}
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(app.accessLogMiddleware)
+	r.Get("/posts/{postId}", func(w http.ResponseWriter, r *http.Request) {
+		setRequestUser(r, 42)
+		switch chi.URLParam(r, "postId") {
+		case "1":
+			w.Write([]byte("ok"))
+		case "2":
+			app.NotFoundError(w, r, errors.New("post not found"))
+		default:
+			app.StatusInternalServerError(w, r, errors.New("database is down"))
+		}
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		level  zapcore.Level
+	}{
+		{"/posts/1", http.StatusOK, zapcore.InfoLevel},
+		{"/posts/2", http.StatusNotFound, zapcore.WarnLevel},
+		{"/posts/3", http.StatusInternalServerError, zapcore.ErrorLevel},
+	}
+	for _, tt := range tests {
+		logs.TakeAll()
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Fatalf("%s: got status %d, want %d", tt.path, rec.Code, tt.status)
+		}
+
+		access := logs.FilterMessage("request").AllUntimed()
+		if len(access) != 1 {
+			t.Fatalf("%s: got access log %v, want one line", tt.path, access)
+		}
+		line := access[0]
+		fields := line.ContextMap()
+		if line.Level != tt.level || fields["status"] != int64(tt.status) || fields["route"] != "/posts/{postId}" {
+			t.Errorf("%s: got access log at %v with %v", tt.path, line.Level, fields)
+		}
+		// the user is known only after the log line was tagged, it still gets it
+		if fields["user_id"] != int64(42) || fields["request_id"] == "" {
+			t.Errorf("%s: got access log fields %v, want the user and request IDs", tt.path, fields)
+		}
+
+		if tt.status != http.StatusInternalServerError {
+			continue
+		}
+		// the error line, the access line and the response share the request ID
+		errs := logs.FilterMessage("internal server ").AllUntimed()
+		if len(errs) != 1 {
+			t.Fatalf("got error log %v, want one line", errs)
+		}
+		errFields := errs[0].ContextMap()
+		if errFields["request_id"] != fields["request_id"] || errFields["user_id"] != int64(42) {
+			t.Errorf("got error log fields %v, access log fields %v", errFields, fields)
+		}
+		var body struct {
+			RequestID string `json:"request_id"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.RequestID != fields["request_id"] {
+			t.Errorf("the response has request ID %q, the logs %q", body.RequestID, fields["request_id"])
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+	"github.com/likhon22/social/internal/jobs"
+	"github.com/likhon22/social/internal/store"
+)
+
+// mediaTypes are the MIME types accepted for uploads, detected from the
+// content and not from the client's Content-Type. Every image type must be
+// one of jobs.ProcessedMediaTypes, so that its metadata is stripped.
+var mediaTypes = []string{"image/jpeg", "image/png", "image/gif", "video/mp4"}
+
+// @Summary		Upload media
+// @Description	Uploads an image or video as multipart form field "file". The returned ID can be attached to a new post. Images stay pending, without URL, until their metadata is stripped and their variants and blurhash are made in the background
+// @Tags			Media
+// @Accept			multipart/form-data
+// @Produce		json
+// @Param			file	formData	file	true	"Image or video"
+// @Success		201		{object}	store.Media
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		413		{object}	error
+// @Failure		415		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/media [post]
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	maxSize := app.Config.Media.MaxSize
+	// leave room for the multipart boundaries and headers
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file is larger than %d bytes", maxSize))
+			return
+		}
+		app.BadRequestError(w, r, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	defer file.Close()
+	if header.Size > maxSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file is larger than %d bytes", maxSize))
+		return
+	}
+
+	mtype, err := mimetype.DetectReader(file)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	if !mimetype.EqualsAny(mtype.String(), mediaTypes...) {
+		writeJSONError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported media type %s", mtype.String()))
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+
+	user := getAuthUserFromContext(r)
+	media := &store.Media{
+		UserID:      user.ID,
+		Key:         fmt.Sprintf("media/%d/%s%s", user.ID, uuid.NewString(), mtype.Extension()),
+		ContentType: mtype.String(),
+		Size:        header.Size,
+	}
+	// images get their variants made in the background
+	var process *store.OutboxMessage
+	if mimetype.EqualsAny(media.ContentType, jobs.ProcessedMediaTypes...) {
+		if process, err = jobs.NewProcessMediaMessage(media.Key); err != nil {
+			app.StatusInternalServerError(w, r, err)
+			return
+		}
+	}
+	ctx := r.Context()
+	if err := app.blobs.Put(ctx, media.Key, file, media.Size, media.ContentType); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Uploads.Create(ctx, media, process); err != nil {
+		if delErr := app.blobs.Delete(context.Background(), media.Key); delErr != nil {
+			app.requestLogger(r).Warnw("orphaned blob", "key", media.Key, "error", delErr.Error())
+		}
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if media.Status == store.MediaReady {
+		if media.URL, err = app.blobs.SignedURL(ctx, media.Key, app.Config.Media.URLExp); err != nil {
+			app.StatusInternalServerError(w, r, err)
+			return
+		}
+	}
+	if err := writeJSON(w, http.StatusCreated, media); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+// signAttachments fills in the signed URLs of the attachments of the posts
+// and of their variants. Pending and failed images get none, their original
+// still has its metadata.
+func (app *application) signAttachments(ctx context.Context, posts ...*store.Post) error {
+	for _, post := range posts {
+		for i := range post.Attachments {
+			media := &post.Attachments[i]
+			if media.Status != store.MediaReady {
+				continue
+			}
+			url, err := app.blobs.SignedURL(ctx, media.Key, app.Config.Media.URLExp)
+			if err != nil {
+				return err
+			}
+			media.URL = url
+			for j := range media.Variants {
+				url, err := app.blobs.SignedURL(ctx, media.Variants[j].Key, app.Config.Media.URLExp)
+				if err != nil {
+					return err
+				}
+				media.Variants[j].URL = url
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/likhon22/social/internal/metrics"
+)
+
+// appMetrics are the metrics of the API, served on /metrics of the admin
+// server. The business counters are counted even when metrics are disabled,
+// they are just not served.
+type appMetrics struct {
+	registry        *metrics.Registry
+	requestDuration *metrics.Histogram
+	storeDuration   *metrics.Histogram
+
+	registrations *metrics.Counter
+	posts         *metrics.Counter
+	comments      *metrics.Counter
+	// follows is labelled by kind, follow or request for private accounts
+	follows *metrics.Counter
+}
+
+func newMetrics(db *sql.DB) *appMetrics {
+	reg := metrics.NewRegistry()
+	reg.RegisterDBStats(db)
+	return &appMetrics{
+		registry:        reg,
+		requestDuration: reg.NewHistogram("http_request_duration_seconds", "Duration of HTTP requests by route and status.", metrics.DefaultBuckets, "method", "route", "status"),
+		storeDuration:   reg.NewHistogram("store_query_duration_seconds", "Duration of store methods, including their database queries.", metrics.DefaultBuckets, "store", "method"),
+		registrations:   reg.NewCounter("users_registered_total", "Number of users registered."),
+		posts:           reg.NewCounter("posts_created_total", "Number of posts created."),
+		comments:        reg.NewCounter("comments_created_total", "Number of comments and replies created."),
+		follows:         reg.NewCounter("follows_total", "Number of follows and follow requests.", "kind"),
+	}
+}
+
+// metricsMiddleware observes the duration of every request by its route
+// pattern, so that URLs with IDs share a series.
+func (app *application) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(responseStatus(r, ww))
+		app.metrics.requestDuration.Observe(time.Since(start).Seconds(), r.Method, route, status)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/likhon22/social/internal/metrics"
+)
+
+// TestMetricsByRoute checks requests are counted by route pattern, so the IDs
+// in URLs do not make a series each.
+func TestMetricsByRoute(t *testing.T) {
+	reg := metrics.NewRegistry()
+	app := &application{metrics: &appMetrics{
+		requestDuration: reg.NewHistogram("http_request_duration_seconds", "", metrics.DefaultBuckets, "method", "route", "status"),
+	}}
+	r := chi.NewRouter()
+	r.Use(app.metricsMiddleware)
+	r.Get("/posts/{postId}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "postId") == "0" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	for _, path := range []string{"/posts/1", "/posts/2", "/posts/0", "/nowhere/1", "/nowhere/2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range []string{
+		`http_request_duration_seconds_count{method="GET",route="/posts/{postId}",status="200"} 2`,
+		`http_request_duration_seconds_count{method="GET",route="/posts/{postId}",status="400"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("missing %q in\n%s", line, rec.Body)
+		}
+	}
+}
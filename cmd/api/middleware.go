@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/likhon22/social/internal/store"
+)
+
+const (
+	authUserKey contextKey = "authUser"
+	postKey     contextKey = "post"
+	commentKey  contextKey = "comment"
+)
+
+// AuthTokenMiddleware validates the bearer access token and puts the
+// authenticated *store.User on the request context. A user already put there by
+// OptionalAuthTokenMiddleware is reused.
+func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getAuthUserFromContext(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") == "" {
+			app.UnauthorizedError(w, r, errors.New("authorization header is missing"))
+			return
+		}
+		user, ok := app.authenticate(w, r)
+		if !ok {
+			return
+		}
+		ctx := context.WithValue(r.Context(), authUserKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// OptionalAuthTokenMiddleware is AuthTokenMiddleware for routes that anonymous
+// users may call too. Without an Authorization header the request goes through
+// with no user on the context, an invalid token is still rejected.
+func (app *application) OptionalAuthTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, ok := app.authenticate(w, r)
+		if !ok {
+			return
+		}
+		ctx := context.WithValue(r.Context(), authUserKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// StreamAuthMiddleware is AuthTokenMiddleware for the event stream, which
+// browsers open with EventSource or WebSocket and cannot send headers with.
+// Without an Authorization header, a stream token made by the stream token
+// route is taken from the token query parameter.
+func (app *application) StreamAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.URL.Query().Get("token")
+		if r.Header.Get("Authorization") != "" || raw == "" {
+			app.AuthTokenMiddleware(next).ServeHTTP(w, r)
+			return
+		}
+		user, ok := app.authenticateToken(w, r, raw, streamTokenScope)
+		if !ok {
+			return
+		}
+		ctx := context.WithValue(r.Context(), authUserKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate resolves the user of the bearer token. It writes the error
+// response itself and returns false when the request must stop.
+func (app *application) authenticate(w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		app.UnauthorizedError(w, r, errors.New("authorization header is malformed"))
+		return nil, false
+	}
+	return app.authenticateToken(w, r, parts[1], "")
+}
+
+// authenticateToken resolves the user of a token of scope, access tokens have
+// none. A token is only good for its own scope: stream tokens travel in URLs
+// and must not open the rest of the API.
+func (app *application) authenticateToken(w http.ResponseWriter, r *http.Request, raw, scope string) (*store.User, bool) {
+	token, err := app.authenticator.ValidateToken(raw)
+	if err != nil {
+		app.UnauthorizedError(w, r, err)
+		return nil, false
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if got, _ := claims["scope"].(string); got != scope {
+		app.UnauthorizedError(w, r, fmt.Errorf("token of scope %q used for %q", got, scope))
+		return nil, false
+	}
+	sub, err := claims.GetSubject()
+	if err != nil {
+		app.UnauthorizedError(w, r, err)
+		return nil, false
+	}
+	userID, err := strconv.ParseInt(sub, 10, 64)
+	if err != nil {
+		app.UnauthorizedError(w, r, err)
+		return nil, false
+	}
+	user, err := app.store.Users.GetUserById(r.Context(), userID)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return nil, false
+	}
+	if user == nil || !user.IsActive {
+		app.UnauthorizedError(w, r, errors.New("user not found or not activated"))
+		return nil, false
+	}
+	setRequestUser(r, user.ID)
+	return user, true
+}
+
+// getViewerID is the ID of the authenticated user, or 0 for anonymous requests.
+func getViewerID(r *http.Request) int64 {
+	if user := getAuthUserFromContext(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+func getAuthUserFromContext(r *http.Request) *store.User {
+	user, _ := r.Context().Value(authUserKey).(*store.User)
+	return user
+}
+
+// postsContextMiddleware loads the post from the {postId} URL param and puts it
+// on the request context.
+func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		postIDParam := chi.URLParam(r, "postId")
+		postID, err := strconv.ParseInt(postIDParam, 10, 64)
+		if err != nil {
+			app.BadRequestError(w, r, err)
+			return
+		}
+		if postID < 1 {
+			app.BadRequestError(w, r, errors.New("invalid ID"))
+			return
+		}
+		ctx := r.Context()
+		post, err := app.store.Posts.GetByID(ctx, postID, getViewerID(r))
+		if err != nil {
+			app.StatusInternalServerError(w, r, err)
+			return
+		}
+		if post == nil {
+			app.NotFoundError(w, r, errors.New("post not found"))
+			return
+		}
+		ctx = context.WithValue(ctx, postKey, post)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getPostFromContext(r *http.Request) *store.Post {
+	post, _ := r.Context().Value(postKey).(*store.Post)
+	return post
+}
+
+// commentsContextMiddleware loads the comment from the {commentId} URL param and
+// puts it on the request context. Deleted comments are not found, unless
+// includeDeleted is set.
+func (app *application) commentsContextMiddleware(includeDeleted bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			commentID, err := strconv.ParseInt(chi.URLParam(r, "commentId"), 10, 64)
+			if err != nil {
+				app.BadRequestError(w, r, err)
+				return
+			}
+			if commentID < 1 {
+				app.BadRequestError(w, r, errors.New("invalid ID"))
+				return
+			}
+			ctx := r.Context()
+			getByID := app.store.Comments.GetByID
+			if includeDeleted {
+				getByID = app.store.Comments.GetByIDIncludingDeleted
+			}
+			comment, err := getByID(ctx, commentID, getViewerID(r))
+			if err != nil {
+				app.StatusInternalServerError(w, r, err)
+				return
+			}
+			if comment == nil {
+				app.NotFoundError(w, r, errors.New("comment not found"))
+				return
+			}
+			ctx = context.WithValue(ctx, commentKey, comment)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func getCommentFromContext(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentKey).(*store.Comment)
+	return comment
+}
+
+// checkPostOwnership lets the owner of the post through, and anyone else only
+// when their role is at least as high as requiredRole. With no requiredRole
+// only the owner goes through.
+func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromContext(r)
+		post := getPostFromContext(r)
+
+		if post.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if requiredRole == "" {
+			app.ForbiddenError(w, r, errors.New("only the author may change the post"))
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.StatusInternalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.ForbiddenError(w, r, errors.New("user does not own the post and lacks the required role"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// checkCommentOwnership lets the author of the comment through, and anyone else
+// only when their role is at least as high as requiredRole. With no
+// requiredRole only the author goes through.
+func (app *application) checkCommentOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromContext(r)
+		comment := getCommentFromContext(r)
+
+		if int64(comment.UserID) == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if requiredRole == "" {
+			app.ForbiddenError(w, r, errors.New("only the author may change the comment"))
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.StatusInternalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.ForbiddenError(w, r, errors.New("user does not own the comment and lacks the required role"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
+	role, err := app.store.Roles.GetByName(ctx, roleName)
+	if err != nil {
+		return false, err
+	}
+	if role == nil {
+		return false, fmt.Errorf("role %q does not exist", roleName)
+	}
+	return user.Role.Level >= role.Level, nil
+}
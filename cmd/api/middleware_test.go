@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// testRoles are the roles of the roles migration.
+type testRoles struct{}
+
+func (testRoles) GetByName(ctx context.Context, name string) (*store.Role, error) {
+	level, ok := map[string]int{"user": 1, "moderator": 2, "admin": 3}[name]
+	if !ok {
+		return nil, nil
+	}
+	return &store.Role{Name: name, Level: level}, nil
+}
+
+func TestOwnership(t *testing.T) {
+	app := &application{
+		store:  &store.Storage{Roles: testRoles{}},
+		logger: zap.NewNop().Sugar(),
+	}
+	const author = 1
+	users := map[string]*store.User{
+		"author":    {ID: author, Role: store.Role{Name: "user", Level: 1}},
+		"user":      {ID: 2, Role: store.Role{Name: "user", Level: 1}},
+		"moderator": {ID: 3, Role: store.Role{Name: "moderator", Level: 2}},
+		"admin":     {ID: 4, Role: store.Role{Name: "admin", Level: 3}},
+	}
+	tests := []struct {
+		user, requiredRole string
+		want               int
+	}{
+		{"author", "", http.StatusOK},
+		{"user", "", http.StatusForbidden},
+		{"moderator", "", http.StatusForbidden},
+		{"admin", "", http.StatusForbidden},
+		{"author", "moderator", http.StatusOK},
+		{"user", "moderator", http.StatusForbidden},
+		{"moderator", "moderator", http.StatusOK},
+		{"admin", "moderator", http.StatusOK},
+		{"moderator", "admin", http.StatusForbidden},
+		{"admin", "owner", http.StatusInternalServerError},
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	for _, tt := range tests {
+		handlers := map[string]http.HandlerFunc{
+			"post":    app.checkPostOwnership(tt.requiredRole, ok),
+			"comment": app.checkCommentOwnership(tt.requiredRole, ok),
+		}
+		for kind, h := range handlers {
+			req := httptest.NewRequest(http.MethodDelete, "/", nil)
+			ctx := context.WithValue(req.Context(), authUserKey, users[tt.user])
+			ctx = context.WithValue(ctx, postKey, &store.Post{ID: 1, UserID: author})
+			ctx = context.WithValue(ctx, commentKey, &store.Comment{ID: 1, UserID: author})
+			rec := httptest.NewRecorder()
+			h(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("%s of the %s with role %q: got status %d, want %d", tt.user, kind, tt.requiredRole, rec.Code, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/likhon22/social/internal/store"
+)
+
+type MarkNotificationsReadPayload struct {
+	IDs []int64 `json:"ids" validate:"omitempty,max=100,dive,gte=1"`
+}
+
+// @Summary		Get notifications
+// @Description	Retrieves a page of the notifications of the authenticated user, most recently updated first by default. Similar unread events are collapsed into one notification with the latest actors and their count
+// @Tags			Notifications
+// @Produce		json
+// @Param			limit	query		int		false	"Page size"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Param			sort	query		string	false	"asc or desc"
+// @Param			unread	query		bool	false	"Only unread notifications"
+// @Success		200		{object}	store.PaginatedResponse[store.Notification]
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/notifications [get]
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := parsePaginatedQuery(r, 20)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	var unreadOnly bool
+	if unread := r.URL.Query().Get("unread"); unread != "" {
+		if unreadOnly, err = strconv.ParseBool(unread); err != nil {
+			app.BadRequestError(w, r, fmt.Errorf("unread must be true or false"))
+			return
+		}
+	}
+	notifications, snapshot, err := app.store.Notifications.GetByUser(r.Context(), getAuthUserFromContext(r).ID, unreadOnly, fq)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	res := store.NewPaginatedResponse(fq, notifications, func(n store.Notification) store.Cursor {
+		return store.Cursor{CreatedAt: n.UpdatedAt, ID: n.ID, Snapshot: snapshot}
+	})
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+// @Summary		Mark notifications read
+// @Description	Marks the given notifications of the authenticated user read, or all of them when no IDs are given
+// @Tags			Notifications
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		MarkNotificationsReadPayload	false	"Notification IDs"
+// @Success		200		{object}	map[string]int64
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/notifications/read [put]
+func (app *application) markNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MarkNotificationsReadPayload
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &payload); err != nil {
+			app.BadRequestError(w, r, err)
+			return
+		}
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	marked, err := app.store.Notifications.MarkRead(r.Context(), getAuthUserFromContext(r).ID, payload.IDs)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := writeJSON(w, http.StatusOK, map[string]int64{"marked": marked}); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+// @Summary		Count unread notifications
+// @Description	Returns the number of unread notifications of the authenticated user
+// @Tags			Notifications
+// @Produce		json
+// @Success		200	{object}	map[string]int
+// @Failure		401	{object}	error
+// @Failure		500	{object}	error
+// @Security		ApiKeyAuth
+// @Router			/notifications/unread-count [get]
+func (app *application) getUnreadCountHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := app.store.Notifications.CountUnread(r.Context(), getAuthUserFromContext(r).ID)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := writeJSON(w, http.StatusOK, map[string]int{"unread": count}); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
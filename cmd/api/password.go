@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/likhon22/social/internal/jobs"
+	"github.com/likhon22/social/internal/mailer"
+	"github.com/likhon22/social/internal/store"
+)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Password string `json:"password" validate:"required,min=5,max=72"`
+}
+
+// @Summary		Request a password reset
+// @Description	Emails a single use password reset link. Always answers 202, whether the email belongs to a user or not
+// @Tags			Users
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		ForgotPasswordPayload	true	"User email"
+// @Success		202		{string}	string					"if the email exists, a reset link has been sent"
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
+// @Router			/users/password/forgot [post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	user, err := app.store.Users.GetUserByEmail(ctx, payload.Email)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+
+	if user != nil && user.IsActive {
+		plainToken := uuid.New().String()
+		email, err := jobs.NewEmailMessage(jobs.EmailPayload{
+			Template: mailer.PasswordResetTemplate,
+			Username: user.Username,
+			Email:    user.Email,
+			Data: map[string]any{
+				"Username":  user.Username,
+				"ResetURL":  fmt.Sprintf("%s/reset-password/%s", app.Config.FrontendURL, plainToken),
+				"ExpiresIn": app.Config.Mail.PasswordResetExp.String(),
+			},
+			IsSandbox: app.Config.Env != "production",
+		})
+		if err != nil {
+			app.StatusInternalServerError(w, r, err)
+			return
+		}
+		err = app.store.Users.CreatePasswordReset(ctx, user.ID, hashToken(plainToken), app.Config.Mail.PasswordResetExp, email)
+		if err != nil {
+			app.StatusInternalServerError(w, r, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusAccepted, "if the email exists, a reset link has been sent")
+}
+
+// @Summary		Reset a password
+// @Description	Sets a new password using the token from the reset email, and signs the user out everywhere
+// @Tags			Users
+// @Accept			json
+// @Produce		json
+// @Param			token	path		string					true	"Reset token"
+// @Param			payload	body		ResetPasswordPayload	true	"New password"
+// @Success		200		{string}	string					"your password has been reset"
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
+// @Router			/users/password/reset/{token} [put]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	var payload ResetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	var password store.Password
+	if err := password.Set(payload.Password); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Users.ResetPassword(r.Context(), hashToken(token), &password); err != nil {
+		if errors.Is(err, store.ErrInvalidResetToken) {
+			app.BadRequestError(w, r, err)
+			return
+		}
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, "your password has been reset")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/likhon22/social/internal/config"
+	"github.com/likhon22/social/internal/jobs"
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// resettingUsers knows an active and an inactive user, and records the password
+// resets made.
+type resettingUsers struct {
+	store.Users
+	resets []passwordReset
+}
+
+type passwordReset struct {
+	userID int64
+	token  string
+	email  jobs.EmailPayload
+}
+
+func (u *resettingUsers) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	switch email {
+	case "active@example.com":
+		return &store.User{ID: 1, Username: "active", Email: email, IsActive: true}, nil
+	case "inactive@example.com":
+		return &store.User{ID: 2, Username: "inactive", Email: email}, nil
+	}
+	return nil, nil
+}
+
+func (u *resettingUsers) CreatePasswordReset(ctx context.Context, userId int64, token string, exp time.Duration, email *store.OutboxMessage) error {
+	reset := passwordReset{userID: userId, token: token}
+	if err := json.Unmarshal(email.Payload, &reset.email); err != nil {
+		return err
+	}
+	u.resets = append(u.resets, reset)
+	return nil
+}
+
+func TestForgotPassword(t *testing.T) {
+	users := &resettingUsers{}
+	app := &application{
+		Config: &config.AppConfig{
+			FrontendURL: "http://localhost:5173",
+			Mail:        &config.MailConfig{PasswordResetExp: time.Hour},
+		},
+		store:  &store.Storage{Users: users},
+		logger: zap.NewNop().Sugar(),
+	}
+	for _, email := range []string{"unknown@example.com", "inactive@example.com", "active@example.com"} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/users/password/forgot", strings.NewReader(`{"email":"`+email+`"}`))
+		rec := httptest.NewRecorder()
+		app.forgotPasswordHandler(rec, req)
+		// the answer does not tell which emails have an account
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("%s: got status %d, want 202", email, rec.Code)
+		}
+	}
+
+	if len(users.resets) != 1 || users.resets[0].userID != 1 {
+		t.Fatalf("got resets %+v, want one of the active user", users.resets)
+	}
+	reset := users.resets[0]
+	url, _ := reset.email.Data["ResetURL"].(string)
+	plainToken, ok := strings.CutPrefix(url, "http://localhost:5173/reset-password/")
+	if !ok || plainToken == "" {
+		t.Fatalf("got reset URL %q", url)
+	}
+	// only the hash of the emailed token is stored
+	if reset.token != hashToken(plainToken) {
+		t.Errorf("stored token %q, want the hash of %q", reset.token, plainToken)
+	}
+}
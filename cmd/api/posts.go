@@ -4,20 +4,30 @@ import (
 	"errors"
 	"log"
 	"net/http"
-	"strconv"
-	"sync"
 
-	"github.com/go-chi/chi/v5"
 	"github.com/likhon22/social/internal/store"
 )
 
 type CreatePostPayload struct {
-	Content string   `json:"content" db:"content" validate:"required,max=1000"`
-	Title   string   `json:"title" db:"title" validate:"required,max=100"`
-	Tags    []string `json:"tags" db:"tags" validate:"required"`
-	UserID  int      `json:"user_id" db:"user_id" validate:"required"`
+	Content    string   `json:"content" db:"content" validate:"required,max=1000"`
+	Title      string   `json:"title" db:"title" validate:"required,max=100"`
+	Tags       []string `json:"tags" db:"tags" validate:"omitempty,max=20,dive,max=100"`
+	Visibility string   `json:"visibility" db:"visibility" validate:"omitempty,oneof=public followers private unlisted"`
+	MediaIDs   []int64  `json:"media_ids" validate:"omitempty,max=10,unique,dive,gte=1"`
 }
 
+// @Summary		Create a new post
+// @Description	Creates a new post. Hashtags in the title and content are added to its tags
+// @Tags			Posts
+// @Accept			json
+// @Produce		json
+// @Param			post	body		CreatePostPayload	true	"Post information"
+// @Success		201		{object}	store.Post
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/posts [post]
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	var payload CreatePostPayload
@@ -31,18 +41,31 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  int64(payload.UserID),
+		Title:      payload.Title,
+		Content:    payload.Content,
+		Tags:       payload.Tags,
+		UserID:     getAuthUserFromContext(r).ID,
+		Visibility: payload.Visibility,
+	}
+	for _, id := range payload.MediaIDs {
+		post.Attachments = append(post.Attachments, store.Media{ID: id})
 	}
 
 	err := app.store.Posts.Create(r.Context(), post)
 	if err != nil {
+		if errors.Is(err, store.ErrInvalidAttachment) {
+			app.BadRequestError(w, r, err)
+			return
+		}
 		log.Println(err)
 		app.StatusInternalServerError(w, r, err)
 		return
 	}
+	app.metrics.posts.Inc()
+	if err := app.signAttachments(r.Context(), post); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
 	if err := writeJSON(w, http.StatusCreated, post); err != nil {
 		app.StatusInternalServerError(w, r, err)
 		return
@@ -51,14 +74,26 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) getPostsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := parsePaginatedQuery(r, 20)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
 
-	posts, err := app.store.Posts.GetAll(r.Context())
+	posts, err := app.store.Posts.GetAll(r.Context(), getViewerID(r), fq)
 	if err != nil {
 		log.Println(err)
 		app.BadRequestError(w, r, err)
 		return
 	}
-	if err := writeJSON(w, http.StatusOK, posts); err != nil {
+	if err := app.signAttachments(r.Context(), posts...); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	res := store.NewPaginatedResponse(fq, posts, func(p *store.Post) store.Cursor {
+		return store.Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+	})
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
 		app.StatusInternalServerError(w, r, err)
 		return
 	}
@@ -66,58 +101,25 @@ func (app *application) getPostsHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (app *application) getPostByIDHandler(w http.ResponseWriter, r *http.Request) {
-	postIDParam := chi.URLParam(r, "postId")
+	post := getPostFromContext(r)
 
-	if postIDParam == "" {
-		app.BadRequestError(w, r, errors.New("postID is needed"))
-		return
-	}
-	postID, err := strconv.ParseInt(postIDParam, 10, 64)
+	// only the first page of top-level threads is embedded, the rest is
+	// paged through /posts/{postId}/comments
+	fq := store.PaginatedFeedQuery{Limit: 20, Sort: "desc"}
+	opts := store.ThreadOptions{Depth: defaultThreadDepth, Replies: defaultThreadReplies}
+	comments, err := app.store.Comments.GetCommentsWithPost(r.Context(), post.ID, fq, opts)
 	if err != nil {
-		app.BadRequestError(w, r, err)
+		app.StatusInternalServerError(w, r, err)
 		return
 	}
-	if postID < 1 {
-		app.BadRequestError(w, r, errors.New("invalid ID"))
-		return
+	post.Comments = *comments
+	if n := len(post.Comments); n > 0 {
+		last := post.Comments[n-1]
+		post.CommentsNextCursor = fq.NextCursor(n, store.Cursor{CreatedAt: last.CreatedAt, ID: int64(last.ID)})
 	}
-	var wg sync.WaitGroup
-	errCh := make(chan error, 2)
-	var post *store.Post
-	var comments []store.Comment
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		p, err := app.store.Posts.GetByID(r.Context(), postID)
-		if err != nil {
-
-			errCh <- err
-			return
-		}
-
-		post = p
-
-	}()
-	go func() {
-		defer wg.Done()
-		c, err := app.store.Comments.GetCommentsWithPost(r.Context(), postID)
-
-		if err != nil {
-			errCh <- err
-			return
-
-		}
-		comments = *c
-
-	}()
-	wg.Wait()
-	close(errCh)
-	for err := range errCh {
+	if err := app.signAttachments(r.Context(), post); err != nil {
 		app.StatusInternalServerError(w, r, err)
-
-	}
-	if post != nil {
-		post.Comments = comments // assign after both are fetched
+		return
 	}
 	if err := writeJSON(w, http.StatusOK, post); err != nil {
 		app.StatusInternalServerError(w, r, err)
@@ -126,22 +128,9 @@ func (app *application) getPostByIDHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (app *application) deletePostByIDHandler(w http.ResponseWriter, r *http.Request) {
-	postIDParam := chi.URLParam(r, "postId")
-	if postIDParam == "" {
-		app.BadRequestError(w, r, errors.New("postID is needed"))
-		return
-	}
-	postID, err := strconv.ParseInt(postIDParam, 10, 64)
-	if err != nil {
-		app.BadRequestError(w, r, err)
-		return
-	}
-	if postID < 1 {
-		app.BadRequestError(w, r, errors.New("invalid ID"))
-		return
-	}
+	post := getPostFromContext(r)
 
-	err = app.store.Posts.Delete(r.Context(), postID)
+	err := app.store.Posts.Delete(r.Context(), post.ID)
 	if err != nil {
 		log.Println(err)
 		app.StatusInternalServerError(w, r, err)
@@ -155,24 +144,15 @@ func (app *application) deletePostByIDHandler(w http.ResponseWriter, r *http.Req
 }
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 	posts := store.Post{}
-	postIDParam := chi.URLParam(r, "postId")
-	if postIDParam == "" {
-		app.BadRequestError(w, r, errors.New("postID is needed"))
+	postID := getPostFromContext(r).ID
+	if err := readJSON(w, r, &posts); err != nil {
+		app.StatusInternalServerError(w, r, err)
 		return
 	}
-	postID, err := strconv.ParseInt(postIDParam, 10, 64)
-	if err != nil {
+	if err := Validate.Var(posts.Visibility, "omitempty,oneof=public followers private unlisted"); err != nil {
 		app.BadRequestError(w, r, err)
 		return
 	}
-	if postID < 1 {
-		app.BadRequestError(w, r, errors.New("invalid ID"))
-		return
-	}
-	if err := readJSON(w, r, &posts); err != nil {
-		app.StatusInternalServerError(w, r, err)
-		return
-	}
 	if err := app.store.Posts.Update(r.Context(), postID, &posts); err != nil {
 		app.StatusInternalServerError(w, r, err)
 		return
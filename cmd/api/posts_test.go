@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// threadComments serves n top-level comments, newest first.
+type threadComments struct {
+	store.Comments
+	n int
+}
+
+func (c threadComments) GetCommentsWithPost(ctx context.Context, postID int64, fq store.PaginatedFeedQuery, opts store.ThreadOptions) (*[]store.Comment, error) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	comments := []store.Comment{}
+	for i := c.n; i > 0 && len(comments) < fq.Limit; i-- {
+		comments = append(comments, store.Comment{
+			ID:        i,
+			PostID:    int(postID),
+			User:      store.CommentAuthor{ID: 2, Username: "commenter"},
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return &comments, nil
+}
+
+func TestGetPostEmbedsCommentsCursor(t *testing.T) {
+	tests := []struct {
+		name       string
+		comments   int
+		wantCursor bool
+	}{
+		{"no comments", 0, false},
+		{"one page", 5, false},
+		{"more pages", 25, true},
+	}
+	for _, tt := range tests {
+		app := &application{
+			store:  &store.Storage{Comments: threadComments{n: tt.comments}},
+			logger: zap.NewNop().Sugar(),
+		}
+		req := httptest.NewRequest(http.MethodGet, "/v1/posts/1", nil)
+		req = req.WithContext(context.WithValue(req.Context(), postKey, &store.Post{ID: 1, UserID: 1}))
+		rec := httptest.NewRecorder()
+		app.getPostByIDHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", tt.name, rec.Code)
+		}
+		var raw struct {
+			Comments json.RawMessage `json:"comments"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(raw.Comments), "email") {
+			t.Errorf("%s: the comments carry emails: %s", tt.name, raw.Comments)
+		}
+
+		var post store.Post
+		if err := json.NewDecoder(rec.Body).Decode(&post); err != nil {
+			t.Fatal(err)
+		}
+		if got := post.CommentsNextCursor != ""; got != tt.wantCursor {
+			t.Fatalf("%s: got cursor %q, want one %v", tt.name, post.CommentsNextCursor, tt.wantCursor)
+		}
+		if !tt.wantCursor {
+			continue
+		}
+		// the cursor continues after the last embedded comment
+		after, err := store.DecodeCursor(post.CommentsNextCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := post.Comments[len(post.Comments)-1]
+		if after.ID != int64(last.ID) || !after.CreatedAt.Equal(last.CreatedAt) {
+			t.Errorf("%s: got cursor %+v, want the last comment %d", tt.name, after, last.ID)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/likhon22/social/internal/ratelimit"
+)
+
+// rateLimit limits the requests of each client under the named policy of the
+// config. Clients learn their budget from the RateLimit headers, and refused
+// ones how long to wait from Retry-After. When the limiter store fails,
+// requests go through.
+func (app *application) rateLimit(name string) func(http.Handler) http.Handler {
+	cfg := app.Config.RateLimit
+	policy, ok := cfg.Policies[name]
+	if !ok {
+		panic(fmt.Sprintf("unknown rate limit policy %q", name))
+	}
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := name + ":" + rateLimitClient(r, policy)
+			res, err := app.rateLimits.Allow(r.Context(), key, policy, time.Now())
+			if err != nil {
+				app.requestLogger(r).Errorw("rate limiter failed", "policy", name, "error", err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Set("RateLimit-Policy", policy.String())
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			if !res.Allowed {
+				app.rateLimitExceededError(w, r, name, ceilSeconds(res.RetryAfter))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitClient identifies who a request is counted for, the user for
+// per-user policies and otherwise the IP address clientIPMiddleware resolved.
+func rateLimitClient(r *http.Request, policy ratelimit.Policy) string {
+	if policy.PerUser {
+		if user := getAuthUserFromContext(r); user != nil {
+			return fmt.Sprintf("user:%d", user.ID)
+		}
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip
+}
+
+// ceilSeconds rounds d up to whole seconds, as the headers count them.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/likhon22/social/internal/config"
+	"github.com/likhon22/social/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+func newRateLimitedApp(trusted ...string) (*application, http.Handler) {
+	app := &application{
+		Config: &config.AppConfig{
+			RateLimit: &config.RateLimitConfig{
+				Enabled: true,
+				Policies: map[string]ratelimit.Policy{
+					"auth": {Algorithm: ratelimit.SlidingWindow, Requests: 3, Window: time.Minute},
+				},
+			},
+		},
+		logger:     zap.NewNop().Sugar(),
+		rateLimits: ratelimit.NewMemory(),
+	}
+	for _, proxy := range trusted {
+		app.Config.TrustedProxies = append(app.Config.TrustedProxies, netip.MustParsePrefix(proxy))
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	return app, app.clientIPMiddleware(app.rateLimit("auth")(ok))
+}
+
+func TestRateLimitIgnoresSpoofedForwardingHeaders(t *testing.T) {
+	_, h := newRateLimitedApp()
+	for i := range 5 {
+		req := httptest.NewRequest(http.MethodPost, "/v1/authentication/token", nil)
+		req.RemoteAddr = "203.0.113.7:4000"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+		req.Header.Set("X-Real-IP", fmt.Sprintf("192.0.2.%d", i))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		want := http.StatusOK
+		if i >= 3 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Errorf("request %d: got status %d, want %d", i, rec.Code, want)
+		}
+	}
+}
+
+func TestRateLimitCountsClientsBehindTrustedProxy(t *testing.T) {
+	_, h := newRateLimitedApp("10.0.0.0/8")
+	send := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/authentication/token", nil)
+		req.RemoteAddr = "10.0.0.2:4000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for range 3 {
+		if code := send("198.51.100.1"); code != http.StatusOK {
+			t.Fatalf("got status %d, want 200", code)
+		}
+	}
+	if code := send("198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("fourth request of the client: got status %d, want 429", code)
+	}
+	// a client prepending made-up hops is still the address the proxy saw
+	if code := send("192.0.2.99, 198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("spoofed hop: got status %d, want 429", code)
+	}
+	if code := send("198.51.100.2"); code != http.StatusOK {
+		t.Errorf("another client: got status %d, want 200", code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.1, fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		remote       string
+		forwardedFor []string
+		realIP       string
+		want         string
+	}{
+		{name: "untrusted peer", remote: "203.0.113.7:1", forwardedFor: []string{"198.51.100.1"}, realIP: "192.0.2.1", want: ""},
+		{name: "no headers", remote: "10.0.0.1:1", want: ""},
+		{name: "real ip", remote: "10.0.0.1:1", realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "forwarded for", remote: "10.0.0.1:1", forwardedFor: []string{"198.51.100.1"}, realIP: "192.0.2.1", want: "198.51.100.1"},
+		{name: "proxy chain", remote: "10.0.0.1:1", forwardedFor: []string{"192.0.2.9, 198.51.100.1, 10.1.1.1"}, want: "198.51.100.1"},
+		{name: "several headers", remote: "10.0.0.1:1", forwardedFor: []string{"198.51.100.1", "192.168.1.1"}, want: "198.51.100.1"},
+		{name: "only proxies", remote: "10.0.0.1:1", forwardedFor: []string{"10.2.2.2"}, want: "10.2.2.2"},
+		{name: "malformed hop", remote: "10.0.0.1:1", forwardedFor: []string{"198.51.100.1, garbage, 10.1.1.1"}, want: "10.1.1.1"},
+		{name: "ipv6 proxy", remote: "[fd00::1]:1", forwardedFor: []string{"2001:db8::1"}, want: "2001:db8::1"},
+		{name: "mapped ipv4 peer", remote: "[::ffff:10.0.0.1]:1", forwardedFor: []string{"198.51.100.1"}, want: "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remote
+		for _, value := range tt.forwardedFor {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+		ip, ok := clientIP(req, trusted)
+		got := ""
+		if ok {
+			got = ip.String()
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, bad := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0.1/8/8"} {
+		if _, err := parseTrustedProxies(bad); err == nil {
+			t.Errorf("%q: parsed without error", bad)
+		}
+	}
+	got, err := parseTrustedProxies(" 10.1.2.3/8 ,, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].String() != "10.0.0.0/8" || got[1].String() != "::1/128" {
+		t.Errorf("got %v", got)
+	}
+}
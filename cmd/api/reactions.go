@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/likhon22/social/internal/store"
+)
+
+type ReactionPayload struct {
+	Type string `json:"type" validate:"required,oneof=like love haha wow sad angry"`
+}
+
+// @Summary		React to a post
+// @Description	Sets the reaction of the authenticated user on a post, replacing a previous one
+// @Tags			Reactions
+// @Accept			json
+// @Produce		json
+// @Param			postId	path		int				true	"Post ID"
+// @Param			payload	body		ReactionPayload	true	"Reaction type"
+// @Success		200		{object}	store.Reaction
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/posts/{postId}/reactions [put]
+func (app *application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	postID := getPostFromContext(r).ID
+	app.setReaction(w, r, &store.Reaction{PostID: &postID})
+}
+
+// @Summary		React to a comment
+// @Description	Sets the reaction of the authenticated user on a comment, replacing a previous one
+// @Tags			Reactions
+// @Accept			json
+// @Produce		json
+// @Param			commentId	path		int				true	"Comment ID"
+// @Param			payload		body		ReactionPayload	true	"Reaction type"
+// @Success		200			{object}	store.Reaction
+// @Failure		400			{object}	error
+// @Failure		401			{object}	error
+// @Failure		404			{object}	error
+// @Failure		500			{object}	error
+// @Security		ApiKeyAuth
+// @Router			/comments/{commentId}/reactions [put]
+func (app *application) reactToCommentHandler(w http.ResponseWriter, r *http.Request) {
+	commentID := int64(getCommentFromContext(r).ID)
+	app.setReaction(w, r, &store.Reaction{CommentID: &commentID})
+}
+
+func (app *application) setReaction(w http.ResponseWriter, r *http.Request, reaction *store.Reaction) {
+	var payload ReactionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	reaction.UserID = getAuthUserFromContext(r).ID
+	reaction.Type = payload.Type
+	if err := app.store.Reactions.Set(r.Context(), reaction); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := writeJSON(w, http.StatusOK, reaction); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+// @Summary		Remove a reaction from a post
+// @Tags			Reactions
+// @Param			postId	path	int	true	"Post ID"
+// @Success		204
+// @Failure		401	{object}	error
+// @Failure		404	{object}	error
+// @Failure		500	{object}	error
+// @Security		ApiKeyAuth
+// @Router			/posts/{postId}/reactions [delete]
+func (app *application) deletePostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.store.Reactions.DeletePostReaction(r.Context(), getPostFromContext(r).ID, getAuthUserFromContext(r).ID)
+	app.writeReactionDeleted(w, r, err)
+}
+
+// @Summary		Remove a reaction from a comment
+// @Tags			Reactions
+// @Param			commentId	path	int	true	"Comment ID"
+// @Success		204
+// @Failure		401	{object}	error
+// @Failure		404	{object}	error
+// @Failure		500	{object}	error
+// @Security		ApiKeyAuth
+// @Router			/comments/{commentId}/reactions [delete]
+func (app *application) deleteCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.store.Reactions.DeleteCommentReaction(r.Context(), int64(getCommentFromContext(r).ID), getAuthUserFromContext(r).ID)
+	app.writeReactionDeleted(w, r, err)
+}
+
+func (app *application) writeReactionDeleted(w http.ResponseWriter, r *http.Request, err error) {
+	if err != nil {
+		if errors.Is(err, store.ErrReactionNotFound) {
+			app.NotFoundError(w, r, err)
+			return
+		}
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/likhon22/social/internal/store"
+)
+
+// @Summary		Search
+// @Description	Ranked full text search over posts or comments, and fuzzy search over usernames
+// @Tags			Search
+// @Produce		json
+// @Param			q		query		string	true	"Search terms, supports quotes, or and -"
+// @Param			type	query		string	false	"posts (default), comments or users"
+// @Param			limit	query		int		false	"Page size"
+// @Param			page	query		int		false	"Page number"
+// @Success		200		{object}	store.PaginatedResponse[store.SearchResult]
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
+// @Router			/search [get]
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := parsePaginatedQuery(r, 20)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	// results are ordered by rank, so they page by offset only
+	if fq.After != nil {
+		app.BadRequestError(w, r, errors.New("search does not support cursors, use page"))
+		return
+	}
+	fq.Search = r.URL.Query().Get("q")
+	if fq.Search == "" {
+		app.BadRequestError(w, r, errors.New("q is needed"))
+		return
+	}
+	if err := Validate.Struct(fq); err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+
+	var results []store.SearchResult
+	switch r.URL.Query().Get("type") {
+	case "", "posts":
+		results, err = app.store.Search.SearchPosts(r.Context(), getViewerID(r), fq)
+	case "comments":
+		results, err = app.store.Search.SearchComments(r.Context(), getViewerID(r), fq)
+	case "users":
+		results, err = app.store.Search.SearchUsers(r.Context(), fq)
+	default:
+		app.BadRequestError(w, r, errors.New("type must be one of posts, comments, users"))
+		return
+	}
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := writeJSON(w, http.StatusOK, store.PaginatedResponse[store.SearchResult]{Data: results}); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// recordedSearch records the search it was asked for and answers with one
+// result.
+type recordedSearch struct {
+	kind     string
+	fq       store.PaginatedFeedQuery
+	viewerID int64
+}
+
+func (s *recordedSearch) SearchPosts(ctx context.Context, viewerId int64, fq store.PaginatedFeedQuery) ([]store.SearchResult, error) {
+	return s.record("post", viewerId, fq)
+}
+
+func (s *recordedSearch) SearchComments(ctx context.Context, viewerId int64, fq store.PaginatedFeedQuery) ([]store.SearchResult, error) {
+	return s.record("comment", viewerId, fq)
+}
+
+func (s *recordedSearch) SearchUsers(ctx context.Context, fq store.PaginatedFeedQuery) ([]store.SearchResult, error) {
+	return s.record("user", 0, fq)
+}
+
+func (s *recordedSearch) record(kind string, viewerID int64, fq store.PaginatedFeedQuery) ([]store.SearchResult, error) {
+	s.kind, s.viewerID, s.fq = kind, viewerID, fq
+	return []store.SearchResult{{Type: kind, ID: 1, Snippet: "a <b>match</b> &lt;i&gt;"}}, nil
+}
+
+func search(t *testing.T, query url.Values) (*recordedSearch, *httptest.ResponseRecorder) {
+	t.Helper()
+	s := &recordedSearch{}
+	app := &application{
+		store:  &store.Storage{Search: s},
+		logger: zap.NewNop().Sugar(),
+	}
+	req := httptest.NewRequest(http.MethodGet, "/v1/search?"+query.Encode(), nil)
+	req = req.WithContext(context.WithValue(req.Context(), authUserKey, &store.User{ID: 7}))
+	rec := httptest.NewRecorder()
+	app.searchHandler(rec, req)
+	return s, rec
+}
+
+// TestSearchPassesOperators checks the quotes, or and - of a search reach the
+// store as they were typed, for Postgres to parse.
+func TestSearchPassesOperators(t *testing.T) {
+	tests := []struct {
+		q, typ, wantKind string
+	}{
+		{`"quick brown" fox`, "", "post"},
+		{`fox or dog`, "posts", "post"},
+		{`quick -fox`, "comments", "comment"},
+		{`"a phrase" or -word`, "comments", "comment"},
+		{`ali_ce%`, "users", "user"},
+	}
+	for _, tt := range tests {
+		s, rec := search(t, url.Values{"q": {tt.q}, "type": {tt.typ}, "page": {"2"}})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: got status %d: %s", tt.q, rec.Code, rec.Body)
+		}
+		if s.kind != tt.wantKind {
+			t.Errorf("%q: searched %s, want %s", tt.q, s.kind, tt.wantKind)
+		}
+		if s.fq.Search != tt.q {
+			t.Errorf("got search %q, want %q", s.fq.Search, tt.q)
+		}
+		if s.fq.Offset != 20 {
+			t.Errorf("%q: got offset %d, want the second page of 20", tt.q, s.fq.Offset)
+		}
+		if tt.wantKind != "user" && s.viewerID != 7 {
+			t.Errorf("%q: searched for viewer %d, want 7", tt.q, s.viewerID)
+		}
+	}
+}
+
+// TestSearchKeepsSnippets checks the HTML of snippets, escaped by the store,
+// reaches the client unchanged.
+func TestSearchKeepsSnippets(t *testing.T) {
+	_, rec := search(t, url.Values{"q": {"match"}})
+	var res store.PaginatedResponse[store.SearchResult]
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data) != 1 || res.Data[0].Snippet != "a <b>match</b> &lt;i&gt;" {
+		t.Errorf("got %+v", res.Data)
+	}
+}
+
+func TestSearchRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{"no q", url.Values{}},
+		{"unknown type", url.Values{"q": {"fox"}, "type": {"tags"}}},
+		{"cursor", url.Values{"q": {"fox"}, "cursor": {store.Cursor{ID: 1}.Encode()}}},
+		{"long q", url.Values{"q": {strings.Repeat("fox ", 26)}}},
+	}
+	for _, tt := range tests {
+		s, rec := search(t, tt.query)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want 400", tt.name, rec.Code)
+		}
+		if s.kind != "" {
+			t.Errorf("%s: searched %s", tt.name, s.kind)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/likhon22/social/internal/store"
+	"github.com/likhon22/social/internal/stream"
+)
+
+// streamHeartbeat keeps idle streams open through proxies and finds clients
+// that are gone.
+const streamHeartbeat = 30 * time.Second
+
+// streamTokenScope marks the tokens that only open the event stream, and
+// streamTokenExp is how long they may be used to open it.
+const (
+	streamTokenScope = "stream"
+	streamTokenExp   = time.Minute
+)
+
+type StreamTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// StreamCommand subscribes a WebSocket stream to the comments of a post, or
+// unsubscribes it.
+type StreamCommand struct {
+	Action string `json:"action" validate:"required,oneof=subscribe unsubscribe"`
+	PostID int64  `json:"post_id" validate:"required,gte=1"`
+}
+
+// @Summary		Stream events
+// @Description	Streams the notifications of the authenticated user, the new posts of the users they follow and the new comments on the posts they view. Events are sent as Server-Sent Events, or as WebSocket messages when the request asks for an upgrade. Posts to stream the comments of are given with post query parameters, and on a WebSocket also with {"action": "subscribe", "post_id": 1} and {"action": "unsubscribe", "post_id": 1} messages
+// @Tags			Stream
+// @Produce		text/event-stream
+// @Param			post	query		[]int	false	"IDs of posts to stream the comments of"	collectionFormat(multi)
+// @Param			token	query		string	false	"Stream token, for clients that cannot send an Authorization header"
+// @Success		200		{object}	store.StreamEvent
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		403		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/stream [get]
+func (app *application) streamHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := getAuthUserFromContext(r)
+	followed, err := app.store.Followers.GetFollowedIDs(ctx, user.ID)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	topics := []string{store.NotificationsTopic(user.ID)}
+	for _, id := range followed {
+		topics = append(topics, store.PostsTopic(id))
+	}
+	for _, value := range r.URL.Query()["post"] {
+		postID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			app.BadRequestError(w, r, fmt.Errorf("invalid post %q", value))
+			return
+		}
+		if err := app.checkStreamPost(ctx, postID, user.ID); err != nil {
+			if errors.Is(err, errStreamPostNotFound) {
+				app.NotFoundError(w, r, err)
+				return
+			}
+			app.StatusInternalServerError(w, r, err)
+			return
+		}
+		topics = append(topics, store.CommentsTopic(postID))
+	}
+
+	sub := app.hub.Subscribe(user.ID, topics...)
+	defer sub.Close()
+	if stream.IsWebSocket(r) {
+		app.serveWebSocket(w, r, sub)
+		return
+	}
+	app.serveSSE(w, r, sub)
+}
+
+// @Summary		Create a stream token
+// @Description	Creates a token that opens the event stream for a minute. Browsers cannot send an Authorization header with EventSource or WebSocket, they pass it in the token query parameter instead. It opens nothing else
+// @Tags			Stream
+// @Produce		json
+// @Success		201	{object}	StreamTokenResponse
+// @Failure		401	{object}	error
+// @Failure		500	{object}	error
+// @Security		ApiKeyAuth
+// @Router			/stream/token [post]
+func (app *application) createStreamTokenHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":   strconv.FormatInt(getAuthUserFromContext(r).ID, 10),
+		"exp":   now.Add(streamTokenExp).Unix(),
+		"iat":   now.Unix(),
+		"nbf":   now.Unix(),
+		"iss":   app.Config.Auth.Token.Iss,
+		"aud":   app.Config.Auth.Token.Iss,
+		"scope": streamTokenScope,
+	}
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := writeJSON(w, http.StatusCreated, StreamTokenResponse{Token: token}); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+var errStreamPostNotFound = errors.New("post not found")
+
+// checkStreamPost makes sure the user may see the post they want the comments
+// of.
+func (app *application) checkStreamPost(ctx context.Context, postID, userID int64) error {
+	post, err := app.store.Posts.GetByID(ctx, postID, userID)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return errStreamPostNotFound
+	}
+	return nil
+}
+
+// streamRecipients checks post and comment events against what their
+// subscribers may see now, in one query per event. Since their stream started
+// they may have unfollowed or muted the author, been blocked, had their follow
+// request rejected, or the post may have turned private.
+func streamRecipients(s *store.Storage) stream.Authorizer {
+	return func(ctx context.Context, ev store.StreamEvent, userIDs []int64) ([]int64, error) {
+		var data struct {
+			ID     int64 `json:"id"`
+			UserID int64 `json:"user_id"`
+			PostID int64 `json:"post_id"`
+		}
+		switch ev.Type {
+		case store.StreamPost:
+			if err := json.Unmarshal(ev.Data, &data); err != nil {
+				return nil, err
+			}
+			followers, err := s.Followers.FilterFollowers(ctx, data.UserID, userIDs)
+			if err != nil || len(followers) == 0 {
+				return nil, err
+			}
+			return s.Posts.FilterViewers(ctx, data.ID, followers)
+		case store.StreamComment:
+			if err := json.Unmarshal(ev.Data, &data); err != nil {
+				return nil, err
+			}
+			return s.Posts.FilterViewers(ctx, data.PostID, userIDs)
+		}
+		// notifications are checked when they are raised
+		return userIDs, nil
+	}
+}
+
+func (app *application) serveSSE(w http.ResponseWriter, r *http.Request, sub *stream.Subscription) {
+	rc := http.NewResponseController(w)
+	// the write timeout of the server would cut the stream off
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", 5000); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Done():
+			return
+		case ev := <-sub.C:
+			var data []byte
+			if data, err = json.Marshal(ev); err == nil {
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			}
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (app *application) serveWebSocket(w http.ResponseWriter, r *http.Request, sub *stream.Subscription) {
+	conn, err := stream.Upgrade(w, r, app.Config.AllowedOrigins)
+	if err != nil {
+		if errors.Is(err, stream.ErrBadHandshake) {
+			app.BadRequestError(w, r, err)
+			return
+		}
+		if errors.Is(err, stream.ErrBadOrigin) {
+			app.ForbiddenError(w, r, err)
+			return
+		}
+		app.requestLogger(r).Warnw("websocket upgrade failed", "error", err.Error())
+		return
+	}
+	defer conn.Close(stream.CloseGoingAway, "")
+
+	user := getAuthUserFromContext(r)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			reply := app.runStreamCommand(r, sub, user.ID, msg)
+			if err := writeStreamEvent(conn, reply); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-done:
+			return
+		case <-r.Context().Done():
+			return
+		case <-sub.Done():
+			return
+		case ev := <-sub.C:
+			err = writeStreamEvent(conn, ev)
+		case <-heartbeat.C:
+			err = conn.Ping()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// runStreamCommand applies a message of a WebSocket client and returns the
+// event to reply with.
+func (app *application) runStreamCommand(r *http.Request, sub *stream.Subscription, userID int64, msg []byte) store.StreamEvent {
+	var cmd StreamCommand
+	err := json.Unmarshal(msg, &cmd)
+	if err == nil {
+		err = Validate.Struct(cmd)
+	}
+	if err == nil && cmd.Action == "subscribe" {
+		if err = app.checkStreamPost(r.Context(), cmd.PostID, userID); err != nil && !errors.Is(err, errStreamPostNotFound) {
+			app.requestLogger(r).Errorw("stream subscription failed", "post_id", cmd.PostID, "error", err.Error())
+			err = errors.New("the server encountered a problem")
+		}
+	}
+	if err != nil {
+		data, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return store.StreamEvent{Type: "error", Data: data}
+	}
+
+	topic := store.CommentsTopic(cmd.PostID)
+	if cmd.Action == "subscribe" {
+		sub.Add(topic)
+	} else {
+		sub.Remove(topic)
+	}
+	data, _ := json.Marshal(map[string]int64{"post_id": cmd.PostID})
+	return store.StreamEvent{Topic: topic, Type: cmd.Action + "d", Data: data}
+}
+
+func writeStreamEvent(conn *stream.Conn, ev store.StreamEvent) error {
+	msg, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return conn.WriteText(msg)
+}
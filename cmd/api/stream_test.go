@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/likhon22/social/internal/auth"
+	"github.com/likhon22/social/internal/config"
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// activeUsers finds every user as an active one.
+type activeUsers struct {
+	store.Users
+}
+
+func (activeUsers) GetUserById(ctx context.Context, id int64) (*store.User, error) {
+	return &store.User{ID: id, IsActive: true}, nil
+}
+
+func newAuthApp() *application {
+	return &application{
+		Config: &config.AppConfig{
+			Auth: &config.AuthConfig{Token: config.TokenConfig{Secret: "test", Exp: time.Minute, Iss: "gosocial"}},
+		},
+		authenticator: auth.NewJWTAuthenticator("test", "gosocial", "gosocial"),
+		store:         &store.Storage{Users: activeUsers{}},
+		logger:        zap.NewNop().Sugar(),
+	}
+}
+
+func (app *application) testToken(t *testing.T, scope string) string {
+	t.Helper()
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": "7",
+		"exp": now.Add(time.Minute).Unix(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"iss": "gosocial",
+		"aud": "gosocial",
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestStreamTokenScope(t *testing.T) {
+	app := newAuthApp()
+	access := app.testToken(t, "")
+	streamToken := app.testToken(t, streamTokenScope)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getAuthUserFromContext(r) == nil {
+			t.Error("no user in the context")
+		}
+	})
+
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		header     string
+		query      string
+		want       int
+	}{
+		{"access token in the header", app.StreamAuthMiddleware, "Bearer " + access, "", http.StatusOK},
+		{"stream token in the query", app.StreamAuthMiddleware, "", streamToken, http.StatusOK},
+		{"access token in the query", app.StreamAuthMiddleware, "", access, http.StatusUnauthorized},
+		{"stream token in the header", app.StreamAuthMiddleware, "Bearer " + streamToken, "", http.StatusUnauthorized},
+		{"no token", app.StreamAuthMiddleware, "", "", http.StatusUnauthorized},
+		{"stream token for another route", app.AuthTokenMiddleware, "Bearer " + streamToken, "", http.StatusUnauthorized},
+		{"query token for another route", app.AuthTokenMiddleware, "", streamToken, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/stream?token="+tt.query, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		tt.middleware(ok).ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestCreateStreamToken(t *testing.T) {
+	app := newAuthApp()
+	req := httptest.NewRequest(http.MethodPost, "/v1/stream/token", nil)
+	req.Header.Set("Authorization", "Bearer "+app.testToken(t, ""))
+	rec := httptest.NewRecorder()
+	app.AuthTokenMiddleware(http.HandlerFunc(app.createStreamTokenHandler)).ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want 201", rec.Code)
+	}
+
+	var res StreamTokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	token, err := app.authenticator.ValidateToken(res.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["scope"] != streamTokenScope || claims["sub"] != "7" {
+		t.Errorf("got claims %v", claims)
+	}
+	if exp, _ := claims.GetExpirationTime(); exp.After(time.Now().Add(streamTokenExp)) {
+		t.Errorf("the token expires at %v, later than a minute from now", exp)
+	}
+}
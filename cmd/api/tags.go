@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/likhon22/social/internal/store"
+)
+
+// trendingWindows are the sliding windows trending tags can be counted over.
+var trendingWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": time.Hour * 24,
+	"7d":  time.Hour * 24 * 7,
+}
+
+// @Summary		Get the posts of a hashtag
+// @Description	Retrieves a page of the posts using a hashtag, newest first by default
+// @Tags			Tags
+// @Produce		json
+// @Param			tag		path		string	true	"Hashtag without the #"
+// @Param			limit	query		int		false	"Page size"
+// @Param			page	query		int		false	"Page number, ignored when cursor is set"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Param			sort	query		string	false	"asc or desc"
+// @Success		200		{object}	store.PaginatedResponse[store.Post]
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
+// @Router			/tags/{tag}/posts [get]
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := parsePaginatedQuery(r, 20)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	posts, err := app.store.Posts.GetByTag(r.Context(), chi.URLParam(r, "tag"), getViewerID(r), fq)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := app.signAttachments(r.Context(), posts...); err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	res := store.NewPaginatedResponse(fq, posts, func(p *store.Post) store.Cursor {
+		return store.Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+	})
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
+
+// @Summary		Get the trending hashtags
+// @Description	Counts the uses of hashtags in public posts and their comments over a sliding window
+// @Tags			Tags
+// @Produce		json
+// @Param			window	query		string	false	"1h, 24h or 7d, 24h by default"
+// @Param			limit	query		int		false	"Number of tags, 1 to 50"
+// @Success		200		{array}		store.TrendingTag
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
+// @Router			/tags/trending [get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	window := trendingWindows["24h"]
+	if v := qs.Get("window"); v != "" {
+		var ok bool
+		if window, ok = trendingWindows[v]; !ok {
+			app.BadRequestError(w, r, errors.New("window must be 1h, 24h or 7d"))
+			return
+		}
+	}
+	limit := 10
+	if v := qs.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 50 {
+			app.BadRequestError(w, r, errors.New("limit must be between 1 and 50"))
+			return
+		}
+		limit = n
+	}
+	tags, err := app.store.Hashtags.GetTrending(r.Context(), window, limit)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := writeJSON(w, http.StatusOK, tags); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
@@ -65,53 +65,122 @@ func (app *application) getUserByEmailHandler(w http.ResponseWriter, r *http.Req
 	}
 }
 
+type UserProfile struct {
+	*store.User
+	store.FollowCounts
+}
+
 // @Summary		Get a user by ID
-// @Description	Retrieves a single user by their ID
+// @Description	Retrieves a single user by their ID, with their follower and following counts
 // @Tags			Users
 // @Produce		json
 // @Param			userId	path		int	true	"User ID"
-// @Success		200		{object}	store.User
+// @Success		200		{object}	UserProfile
 // @Failure		400		{object}	error
 // @Failure		404		{object}	error
 // @Failure		500		{object}	error
 // @Router			/users/{userId} [get]
 func (app *application) getUserByIdHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
-	if err := writeJSON(w, http.StatusOK, user); err != nil {
+	counts, err := app.store.Followers.GetCounts(r.Context(), user.ID)
+	if err != nil {
+		app.StatusInternalServerError(w, r, err)
+		return
+	}
+	if err := writeJSON(w, http.StatusOK, UserProfile{User: user, FollowCounts: *counts}); err != nil {
 		app.StatusInternalServerError(w, r, err)
 		return
 	}
 }
 
-type FollowUser struct {
-	UserId int64 `json:"user_id"`
+// @Summary		Get the followers of a user
+// @Description	Retrieves a page of the users following a user, most recent first by default
+// @Tags			Users
+// @Produce		json
+// @Param			userId	path		int		true	"User ID"
+// @Param			limit	query		int		false	"Page size"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Param			sort	query		string	false	"asc or desc"
+// @Success		200		{object}	store.PaginatedResponse[store.FollowUser]
+// @Failure		400		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Router			/users/{userId}/followers [get]
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeFollowList(w, r, app.store.Followers.GetFollowers)
 }
 
-// @Summary		Follow a user
-// @Description	Allows the authenticated user to follow another user
+// @Summary		Get the users a user follows
+// @Description	Retrieves a page of the users a user follows, most recent first by default
 // @Tags			Users
-// @Accept			json
 // @Produce		json
-// @Param			userId	path		int			true	"User ID to follow"
-// @Param			payload	body		FollowUser	true	"Authenticated user info (if needed)"
-// @Success		200		{string}	string		"you followed successfully"
+// @Param			userId	path		int		true	"User ID"
+// @Param			limit	query		int		false	"Page size"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Param			sort	query		string	false	"asc or desc"
+// @Success		200		{object}	store.PaginatedResponse[store.FollowUser]
 // @Failure		400		{object}	error
-// @Failure		409		{object}	error	"you already followed"
+// @Failure		404		{object}	error
 // @Failure		500		{object}	error
-// @Router			/users/{userId}/follow [put]
-func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
-	follower := getUserFromContext(r)
+// @Router			/users/{userId}/following [get]
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeFollowList(w, r, app.store.Followers.GetFollowing)
+}
 
-	var payload FollowUser
+type followListFunc func(ctx context.Context, userId int64, viewerId int64, fq store.PaginatedFeedQuery) ([]store.FollowUser, error)
 
-	if err := readJSON(w, r, &payload); err != nil {
+func (app *application) writeFollowList(w http.ResponseWriter, r *http.Request, list followListFunc) {
+	user := getUserFromContext(r)
+	fq, err := parsePaginatedQuery(r, 20)
+	if err != nil {
+		app.BadRequestError(w, r, err)
+		return
+	}
+	users, err := list(r.Context(), user.ID, getViewerID(r), fq)
+	if err != nil {
 		app.StatusInternalServerError(w, r, err)
 		return
+	}
+	res := store.NewPaginatedResponse(fq, users, func(u store.FollowUser) store.Cursor {
+		return store.Cursor{CreatedAt: u.FollowedAt, ID: u.ID}
+	})
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
+		app.StatusInternalServerError(w, r, err)
+	}
+}
 
+// @Summary		Follow a user
+// @Description	Allows the authenticated user to follow another user, following a private account sends a follow request
+// @Tags			Users
+// @Produce		json
+// @Param			userId	path		int		true	"User ID to follow"
+// @Success		200		{string}	string	"you followed successfully"
+// @Success		202		{string}	string	"follow request sent"
+// @Failure		400		{object}	error
+// @Failure		401		{object}	error
+// @Failure		403		{object}	error
+// @Failure		409		{object}	error	"you already followed"
+// @Failure		500		{object}	error
+// @Security		ApiKeyAuth
+// @Router			/users/{userId}/follow [put]
+func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	followedUser := getUserFromContext(r)
+	follower := getAuthUserFromContext(r)
+	if followedUser.ID == follower.ID {
+		app.BadRequestError(w, r, errors.New("you can not follow yourself"))
+		return
 	}
-	log.Println(follower.ID, follower.ID, payload.UserId)
-	err := app.store.Followers.Follow(r.Context(), payload.UserId, follower.ID)
+
+	requested, err := app.store.Followers.Follow(r.Context(), followedUser.ID, follower.ID)
 	if err != nil {
+		if errors.Is(err, store.ErrBlocked) {
+			app.ForbiddenError(w, r, err)
+			return
+		}
+		if errors.Is(err, store.ErrAlreadyFollowing) {
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		}
 		// Check if it's a Postgres unique constraint violation
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23505" { // unique_violation
@@ -123,31 +192,31 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		app.StatusInternalServerError(w, r, err)
 		return
 	}
+	if requested {
+		app.metrics.follows.Inc("request")
+		writeJSON(w, http.StatusAccepted, "follow request sent")
+		return
+	}
+	app.metrics.follows.Inc("follow")
 	writeJSON(w, http.StatusOK, "you followed successfully")
 }
 
 // @Summary		Unfollow a user
-// @Description	Allows the authenticated user to unfollow another user
+// @Description	Allows the authenticated user to unfollow another user or cancel their follow request
 // @Tags			Users
-// @Accept			json
 // @Produce		json
-// @Param			userId	path		int			true	"User ID to unfollow"
-// @Param			payload	body		FollowUser	false	"Optional payload"
-// @Success		204		{string}	string		"you unfollowed successfully"
+// @Param			userId	path		int		true	"User ID to unfollow"
+// @Success		200		{string}	string	"you unfollowed successfully"
 // @Failure		400		{object}	error
+// @Failure		401		{object}	error
 // @Failure		500		{object}	error
+// @Security		ApiKeyAuth
 // @Router			/users/{userId}/unfollow [put]
 func (app *application) unFollowUserHandler(w http.ResponseWriter, r *http.Request) {
-	unFollower := getUserFromContext(r)
-	var payload FollowUser
+	unFollowedUser := getUserFromContext(r)
+	unFollower := getAuthUserFromContext(r)
 
-	if err := readJSON(w, r, &payload); err != nil {
-		app.StatusInternalServerError(w, r, err)
-		return
-
-	}
-	log.Println(unFollower.ID, unFollower.ID, payload.UserId)
-	err := app.store.Followers.UnFOllow(r.Context(), payload.UserId, unFollower.ID)
+	err := app.store.Followers.UnFOllow(r.Context(), unFollowedUser.ID, unFollower.ID)
 	if err != nil {
 		app.StatusInternalServerError(w, r, err)
 		return
@@ -173,6 +242,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.BadRequestError(w, r, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, "you activate your account successfully")
 }
 
 // user middleware
@@ -199,6 +269,10 @@ func (app *application) UserIdContextMiddleware(next http.Handler) http.Handler
 			return
 
 		}
+		if user == nil {
+			app.NotFoundError(w, r, errors.New("user not found"))
+			return
+		}
 		ctx = context.WithValue(r.Context(), userIDKey, user)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
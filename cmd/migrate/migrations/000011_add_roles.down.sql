@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS role_id;
+
+DROP TABLE IF EXISTS roles;
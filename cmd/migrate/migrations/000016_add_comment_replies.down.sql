@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_comments_parent;
+DROP INDEX IF EXISTS idx_comments_post_parent;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
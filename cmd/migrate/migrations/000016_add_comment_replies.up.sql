@@ -0,0 +1,5 @@
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES comments(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_parent ON comments (post_id, parent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments (parent_id, created_at, id) WHERE parent_id IS NOT NULL;
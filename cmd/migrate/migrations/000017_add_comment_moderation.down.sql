@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_comments_user;
+DROP TABLE IF EXISTS comment_edits;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_at;
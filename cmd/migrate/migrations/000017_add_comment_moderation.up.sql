@@ -0,0 +1,13 @@
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS comment_edits (
+    id BIGSERIAL PRIMARY KEY,
+    comment_id INT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    edited_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    edited_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_edits_comment_id ON comment_edits (comment_id, edited_at);
+CREATE INDEX IF NOT EXISTS idx_comments_user ON comments (user_id, created_at, id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_followers_follower_created;
+DROP INDEX IF EXISTS idx_followers_user_created;
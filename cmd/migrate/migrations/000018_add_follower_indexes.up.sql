@@ -0,0 +1,4 @@
+-- the primary key (user_id, follower_id) serves lookups by followed user,
+-- these serve the paginated lists on both sides
+CREATE INDEX IF NOT EXISTS idx_followers_user_created ON followers (user_id, created_at, follower_id);
+CREATE INDEX IF NOT EXISTS idx_followers_follower_created ON followers (follower_id, created_at, user_id);
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_private BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS follow_requests (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    requester_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    PRIMARY KEY (user_id, requester_id),
+    CHECK (user_id <> requester_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follow_requests_user_created ON follow_requests (user_id, created_at, requester_id);
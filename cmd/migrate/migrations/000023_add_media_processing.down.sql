@@ -0,0 +1,6 @@
+ALTER TABLE media
+    DROP COLUMN IF EXISTS variants,
+    DROP COLUMN IF EXISTS blurhash,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS width,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,6 @@
+ALTER TABLE media
+    ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'ready',
+    ADD COLUMN IF NOT EXISTS width INT,
+    ADD COLUMN IF NOT EXISTS height INT,
+    ADD COLUMN IF NOT EXISTS blurhash TEXT,
+    ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_notifications_unread;
+DROP INDEX IF EXISTS idx_notifications_user_updated;
+DROP INDEX IF EXISTS idx_notifications_unread_group;
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications (user_id, created_at, id);
+
+ALTER TABLE notifications
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS actor_count,
+    DROP COLUMN IF EXISTS actor_ids,
+    DROP COLUMN IF EXISTS group_key;
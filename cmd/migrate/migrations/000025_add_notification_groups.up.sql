@@ -0,0 +1,14 @@
+ALTER TABLE notifications
+    ADD COLUMN IF NOT EXISTS group_key TEXT,
+    ADD COLUMN IF NOT EXISTS actor_ids BIGINT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS actor_count INT NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+UPDATE notifications SET actor_ids = ARRAY[actor_id], updated_at = created_at;
+
+-- similar events collapse into the unread notification of their group
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unread_group ON notifications (user_id, group_key) WHERE read_at IS NULL;
+
+DROP INDEX IF EXISTS idx_notifications_user_created;
+CREATE INDEX IF NOT EXISTS idx_notifications_user_updated ON notifications (user_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
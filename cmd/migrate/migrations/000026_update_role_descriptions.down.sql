@@ -0,0 +1,2 @@
+UPDATE roles SET description = 'A moderator can update other users posts' WHERE name = 'moderator';
+UPDATE roles SET description = 'An admin can update and delete other users posts' WHERE name = 'admin';
@@ -0,0 +1,2 @@
+UPDATE roles SET description = 'A moderator can delete other users posts and comments' WHERE name = 'moderator';
+UPDATE roles SET description = 'An admin can delete other users posts and comments' WHERE name = 'admin';
@@ -0,0 +1,15 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// DeriveKey derives the key of one purpose from secret. Keys of different
+// purposes are independent, so a key that leaks from one use does not sign for
+// the others.
+func DeriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	cursor := DeriveKey("secret", "cursor")
+	if !bytes.Equal(cursor, DeriveKey("secret", "cursor")) {
+		t.Error("keys of the same purpose differ")
+	}
+	if bytes.Equal(cursor, DeriveKey("secret", "media url")) {
+		t.Error("keys of two purposes are the same")
+	}
+	if bytes.Equal(cursor, DeriveKey("other secret", "cursor")) {
+		t.Error("keys of two secrets are the same")
+	}
+	if bytes.Equal(cursor, []byte("secret")) || len(cursor) != 32 {
+		t.Errorf("got key %x", cursor)
+	}
+}
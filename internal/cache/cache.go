@@ -0,0 +1,18 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned by Get for keys that are not cached, or have expired.
+var ErrMiss = errors.New("cache miss")
+
+// Cache keeps values for a while. Values are opaque bytes, callers encode
+// them.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
@@ -0,0 +1,243 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisConfig points at a server speaking the Redis protocol, like Redis,
+// Valkey or KeyDB.
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	// PoolSize is how many idle connections are kept.
+	PoolSize int
+}
+
+// Redis is a Cache shared by all API instances, kept in a Redis server. Other
+// users of the server, like the rate limiter, run their own scripts through
+// Eval. It speaks RESP2 over a small pool of connections.
+type Redis struct {
+	cfg    RedisConfig
+	dialer net.Dialer
+	idle   chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+const redisTimeout = 5 * time.Second
+
+func NewRedis(cfg RedisConfig) *Redis {
+	if cfg.PoolSize < 1 {
+		cfg.PoolSize = 1
+	}
+	return &Redis{
+		cfg:    cfg,
+		dialer: net.Dialer{Timeout: redisTimeout},
+		idle:   make(chan *redisConn, cfg.PoolSize),
+	}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := r.do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrMiss
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %T to GET", reply)
+	}
+	return value, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := r.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := r.do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// Eval runs a Lua script on the server, which runs it atomically. The script
+// is sent once and run by its SHA1 after that.
+func (r *Redis) Eval(ctx context.Context, script string, keys []string, args ...string) (any, error) {
+	hash := sha1.Sum([]byte(script))
+	cmd := append([]string{"EVALSHA", hex.EncodeToString(hash[:]), strconv.Itoa(len(keys))}, keys...)
+	cmd = append(cmd, args...)
+	reply, err := r.do(ctx, cmd...)
+	var replyErr redisError
+	if errors.As(err, &replyErr) && strings.HasPrefix(string(replyErr), "NOSCRIPT") {
+		cmd[0], cmd[1] = "EVAL", script
+		return r.do(ctx, cmd...)
+	}
+	return reply, err
+}
+
+// Ping checks that the server can be reached.
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections.
+func (r *Redis) Close() error {
+	for {
+		select {
+		case c := <-r.idle:
+			c.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and returns its reply. Error replies are returned as
+// errors, the connection is kept for them.
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	c, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(ctx, args...)
+	if err != nil {
+		var replyErr redisError
+		if !errors.As(err, &replyErr) {
+			c.conn.Close()
+			return nil, err
+		}
+	}
+	select {
+	case r.idle <- c:
+	default:
+		c.conn.Close()
+	}
+	return reply, err
+}
+
+func (r *Redis) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+	}
+	conn, err := r.dialer.DialContext(ctx, "tcp", r.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, br: bufio.NewReader(conn)}
+	if r.cfg.Password != "" {
+		if _, err := c.do(ctx, "AUTH", r.cfg.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.cfg.DB != 0 {
+		if _, err := c.do(ctx, "SELECT", strconv.Itoa(r.cfg.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) do(ctx context.Context, args ...string) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	// commands are sent as an array of bulk strings
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(c.br)
+}
+
+// readReply reads a RESP2 reply: simple strings as string, errors as
+// redisError, integers as int64, bulk strings as []byte and arrays as []any.
+// Null replies are nil.
+func readReply(br *bufio.Reader) (any, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(br, value); err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(br); err != nil {
+				var replyErr redisError
+				if !errors.As(err, &replyErr) {
+					return nil, err
+				}
+				items[i] = replyErr
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
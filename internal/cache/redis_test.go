@@ -0,0 +1,295 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    any
+		wantErr string
+	}{
+		{name: "simple string", in: "+OK\r\n", want: "OK"},
+		{name: "error", in: "-ERR wrong type\r\n", wantErr: "redis: ERR wrong type"},
+		{name: "integer", in: ":-42\r\n", want: int64(-42)},
+		{name: "bulk string", in: "$5\r\nhello\r\n", want: []byte("hello")},
+		{name: "bulk string with CRLF", in: "$4\r\na\r\nb\r\n", want: []byte("a\r\nb")},
+		{name: "empty bulk string", in: "$0\r\n\r\n", want: []byte{}},
+		{name: "null bulk string", in: "$-1\r\n", want: nil},
+		{name: "array", in: "*3\r\n:1\r\n$1\r\na\r\n+b\r\n", want: []any{int64(1), []byte("a"), "b"}},
+		{name: "nested array", in: "*2\r\n*1\r\n:1\r\n*0\r\n", want: []any{[]any{int64(1)}, []any{}}},
+		{name: "null array", in: "*-1\r\n", want: nil},
+		{name: "array with error", in: "*2\r\n-ERR no\r\n:1\r\n", want: []any{redisError("ERR no"), int64(1)}},
+		{name: "no CR", in: "+OK\n", wantErr: "malformed reply"},
+		{name: "unknown type", in: "?x\r\n", wantErr: "unknown reply type"},
+		{name: "bad integer", in: ":x\r\n", wantErr: "invalid syntax"},
+		{name: "short bulk string", in: "$5\r\nhi\r\n", wantErr: "unexpected EOF"},
+		{name: "truncated", in: "+OK", wantErr: "EOF"},
+	}
+	for _, tt := range tests {
+		got, err := readReply(bufio.NewReader(strings.NewReader(tt.in)))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeRedis is an in-process server speaking enough RESP2 for Redis: strings
+// without expiry, AUTH, SELECT and scripts that return their number of keys.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	dials    int
+	values   map[string]string
+	scripts  map[string]bool
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, password: password, values: map[string]string{}, scripts: map[string]bool{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.dials++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		// commands are arrays of bulk strings, which readReply reads too
+		reply, err := readReply(br)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]any) {
+			args = append(args, string(arg.([]byte)))
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, args[0])
+		var out string
+		switch {
+		case args[0] == "AUTH":
+			authed = args[1] == f.password
+			out = "+OK\r\n"
+			if !authed {
+				out = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			out = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "PING":
+			out = "+PONG\r\n"
+		case args[0] == "SELECT":
+			out = "+OK\r\n"
+		case args[0] == "GET":
+			if value, ok := f.values[args[1]]; ok {
+				out = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				out = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			f.values[args[1]] = args[2]
+			out = "+OK\r\n"
+		case args[0] == "DEL":
+			n := 0
+			for _, key := range args[1:] {
+				if _, ok := f.values[key]; ok {
+					delete(f.values, key)
+					n++
+				}
+			}
+			out = fmt.Sprintf(":%d\r\n", n)
+		case args[0] == "EVALSHA":
+			if f.scripts[args[1]] {
+				out = ":" + args[2] + "\r\n"
+			} else {
+				out = "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+			}
+		case args[0] == "EVAL":
+			hash := sha1.Sum([]byte(args[1]))
+			f.scripts[hex.EncodeToString(hash[:])] = true
+			out = ":" + args[2] + "\r\n"
+		default:
+			out = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+		f.mu.Unlock()
+		if _, err := conn.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) stats() (int, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dials, append([]string(nil), f.commands...)
+}
+
+func TestRedisCache(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	r := NewRedis(RedisConfig{Addr: f.ln.Addr().String(), Password: "secret", DB: 2, PoolSize: 2})
+	defer r.Close()
+	ctx := context.Background()
+
+	if _, err := r.Get(ctx, "user:1"); err != ErrMiss {
+		t.Fatalf("get of a missing key: got %v, want ErrMiss", err)
+	}
+	value := "{\"name\":\"a\r\nb\"}"
+	if err := r.Set(ctx, "user:1", []byte(value), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Get(ctx, "user:1")
+	if err != nil || string(got) != value {
+		t.Fatalf("get: got %q, %v, want %q", got, err, value)
+	}
+	if err := r.Delete(ctx, "user:1", "user:2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Get(ctx, "user:1"); err != ErrMiss {
+		t.Errorf("get after delete: got %v, want ErrMiss", err)
+	}
+
+	// one connection serves every command in turn, set up once
+	dials, commands := f.stats()
+	if dials != 1 {
+		t.Errorf("dialed %d connections, want 1", dials)
+	}
+	want := []string{"AUTH", "SELECT", "GET", "SET", "GET", "DEL", "GET"}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("got commands %v, want %v", commands, want)
+	}
+
+	// error replies keep the connection
+	var replyErr redisError
+	if _, err := r.do(ctx, "FLUSHALL"); !errors.As(err, &replyErr) {
+		t.Errorf("unknown command: got %v, want a redis error", err)
+	}
+	if err := r.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if dials, _ := f.stats(); dials != 1 {
+		t.Errorf("dialed %d connections after an error reply, want 1", dials)
+	}
+}
+
+func TestRedisPool(t *testing.T) {
+	f := newFakeRedis(t, "")
+	r := NewRedis(RedisConfig{Addr: f.ln.Addr().String(), PoolSize: 2})
+	defer r.Close()
+	ctx := context.Background()
+
+	// concurrent commands dial their own connections, the pool keeps two
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	conns := make(chan *redisConn, 4)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			c, err := r.conn(ctx)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conns <- c
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(conns)
+	for c := range conns {
+		if _, err := c.do(ctx, "PING"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case r.idle <- c:
+		default:
+			c.conn.Close()
+		}
+	}
+	if len(r.idle) != 2 {
+		t.Errorf("pool holds %d connections, want 2", len(r.idle))
+	}
+
+	for range 10 {
+		if err := r.Ping(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dials, _ := f.stats(); dials != 4 {
+		t.Errorf("dialed %d connections, want the 4 concurrent ones only", dials)
+	}
+
+	// with the server gone commands fail instead of hanging
+	r.Close()
+	f.ln.Close()
+	if err := r.Ping(ctx); err == nil {
+		t.Error("ping with the server gone succeeded")
+	}
+}
+
+func TestRedisEvalNoScript(t *testing.T) {
+	f := newFakeRedis(t, "")
+	r := NewRedis(RedisConfig{Addr: f.ln.Addr().String()})
+	defer r.Close()
+	ctx := context.Background()
+
+	const script = "return #KEYS"
+	for range 2 {
+		reply, err := r.Eval(ctx, script, []string{"a", "b"}, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply != int64(2) {
+			t.Errorf("got reply %#v, want 2", reply)
+		}
+	}
+	// the script is sent once, when the server does not know it yet
+	_, commands := f.stats()
+	want := []string{"EVALSHA", "EVAL", "EVALSHA"}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("got commands %v, want %v", commands, want)
+	}
+}
@@ -0,0 +1,352 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// UserStore caches the users read by ID in front of store.Users. Only active
+// users are cached, so activation needs no invalidation.
+type UserStore struct {
+	store.Users
+	cache  Cache
+	ttl    time.Duration
+	logger *zap.SugaredLogger
+	group  singleflight.Group
+}
+
+func NewUserStore(users store.Users, cache Cache, ttl time.Duration, logger *zap.SugaredLogger) *UserStore {
+	return &UserStore{Users: users, cache: cache, ttl: ttl, logger: logger}
+}
+
+func userKey(id int64) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+func (s *UserStore) GetUserById(ctx context.Context, id int64) (*store.User, error) {
+	key := userKey(id)
+	if raw := get(ctx, s.cache, s.logger, key); raw != nil {
+		user := &store.User{}
+		if err := json.Unmarshal(raw, user); err == nil {
+			return user, nil
+		}
+	}
+	// concurrent misses share one query, and get their own copy of its result
+	v, err, _ := s.group.Do(key, func() (any, error) {
+		user, err := s.Users.GetUserById(context.WithoutCancel(ctx), id)
+		if err != nil || user == nil {
+			return nil, err
+		}
+		raw, err := json.Marshal(user)
+		if err != nil {
+			return nil, err
+		}
+		if user.IsActive {
+			set(ctx, s.cache, s.logger, key, raw, s.ttl)
+		}
+		return raw, nil
+	})
+	if err != nil || v == nil {
+		return nil, err
+	}
+	user := &store.User{}
+	if err := json.Unmarshal(v.([]byte), user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetPrivate also invalidates the relations of the followers approved by
+// making the account public, which FollowerStore caches in the same cache.
+func (s *UserStore) SetPrivate(ctx context.Context, userId int64, private bool) ([]int64, error) {
+	approved, err := s.Users.SetPrivate(ctx, userId, private)
+	if err != nil {
+		return approved, err
+	}
+	keys := []string{userKey(userId)}
+	for _, id := range approved {
+		keys = append(keys, relationKey(userId, id))
+	}
+	invalidate(ctx, s.cache, s.logger, keys...)
+	return approved, nil
+}
+
+// FollowerStore caches how viewers stand to authors in front of
+// store.Followers, which with the cached users decides who may see a cached
+// post. Follows and blocks invalidate the entries they change, so do the
+// requests approved by UserStore.SetPrivate.
+type FollowerStore struct {
+	store.Followers
+	cache  Cache
+	ttl    time.Duration
+	logger *zap.SugaredLogger
+}
+
+func NewFollowerStore(followers store.Followers, cache Cache, ttl time.Duration, logger *zap.SugaredLogger) *FollowerStore {
+	return &FollowerStore{Followers: followers, cache: cache, ttl: ttl, logger: logger}
+}
+
+func relationKey(userId, viewerId int64) string {
+	return fmt.Sprintf("relation:%d:%d", userId, viewerId)
+}
+
+func (s *FollowerStore) GetRelation(ctx context.Context, userId int64, viewerId int64) (store.Relation, error) {
+	key := relationKey(userId, viewerId)
+	var rel store.Relation
+	if raw := get(ctx, s.cache, s.logger, key); raw != nil {
+		if err := json.Unmarshal(raw, &rel); err == nil {
+			return rel, nil
+		}
+	}
+	rel, err := s.Followers.GetRelation(ctx, userId, viewerId)
+	if err != nil {
+		return rel, err
+	}
+	if raw, err := json.Marshal(rel); err == nil {
+		set(ctx, s.cache, s.logger, key, raw, s.ttl)
+	}
+	return rel, nil
+}
+
+func (s *FollowerStore) Follow(ctx context.Context, userId int64, followerId int64) (bool, error) {
+	requested, err := s.Followers.Follow(ctx, userId, followerId)
+	if err != nil {
+		return requested, err
+	}
+	invalidate(ctx, s.cache, s.logger, relationKey(userId, followerId))
+	return requested, nil
+}
+
+func (s *FollowerStore) UnFOllow(ctx context.Context, userId int64, unFOllowerId int64) error {
+	if err := s.Followers.UnFOllow(ctx, userId, unFOllowerId); err != nil {
+		return err
+	}
+	invalidate(ctx, s.cache, s.logger, relationKey(userId, unFOllowerId))
+	return nil
+}
+
+func (s *FollowerStore) ApproveRequest(ctx context.Context, userId int64, requesterId int64) error {
+	if err := s.Followers.ApproveRequest(ctx, userId, requesterId); err != nil {
+		return err
+	}
+	invalidate(ctx, s.cache, s.logger, relationKey(userId, requesterId))
+	return nil
+}
+
+// BlockStore invalidates the relations cached by FollowerStore when users
+// block or unblock each other.
+type BlockStore struct {
+	store.Blocks
+	cache  Cache
+	logger *zap.SugaredLogger
+}
+
+func NewBlockStore(blocks store.Blocks, cache Cache, logger *zap.SugaredLogger) *BlockStore {
+	return &BlockStore{Blocks: blocks, cache: cache, logger: logger}
+}
+
+// Block also removes the follows in both directions, so both relations go.
+func (s *BlockStore) Block(ctx context.Context, blockerId, blockedId int64) error {
+	if err := s.Blocks.Block(ctx, blockerId, blockedId); err != nil {
+		return err
+	}
+	invalidate(ctx, s.cache, s.logger, relationKey(blockerId, blockedId), relationKey(blockedId, blockerId))
+	return nil
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerId, blockedId int64) error {
+	if err := s.Blocks.Unblock(ctx, blockerId, blockedId); err != nil {
+		return err
+	}
+	invalidate(ctx, s.cache, s.logger, relationKey(blockerId, blockedId), relationKey(blockedId, blockerId))
+	return nil
+}
+
+// PostStore caches the posts read by ID in front of store.Posts. Whether a
+// viewer may see a cached post is decided from the author and the relation of
+// the viewer to them, read through the cached users and followers so a hit
+// needs no query.
+type PostStore struct {
+	store.Posts
+	users     store.Users
+	followers store.Followers
+	cache     Cache
+	ttl       time.Duration
+	logger    *zap.SugaredLogger
+	group     singleflight.Group
+}
+
+func NewPostStore(posts store.Posts, users store.Users, followers store.Followers, cache Cache, ttl time.Duration, logger *zap.SugaredLogger) *PostStore {
+	return &PostStore{Posts: posts, users: users, followers: followers, cache: cache, ttl: ttl, logger: logger}
+}
+
+func postKey(id int64) string {
+	return fmt.Sprintf("post:%d", id)
+}
+
+// cachedPost is how a post is cached. The storage keys of the attachments are
+// left out of the JSON of a post, they are kept beside it.
+type cachedPost struct {
+	Post        store.Post `json:"post"`
+	MediaKeys   []string   `json:"media_keys"`
+	VariantKeys [][]string `json:"variant_keys"`
+}
+
+func encodePost(post *store.Post) ([]byte, error) {
+	entry := cachedPost{Post: *post}
+	for _, media := range post.Attachments {
+		variantKeys := make([]string, len(media.Variants))
+		for i, variant := range media.Variants {
+			variantKeys[i] = variant.Key
+		}
+		entry.MediaKeys = append(entry.MediaKeys, media.Key)
+		entry.VariantKeys = append(entry.VariantKeys, variantKeys)
+	}
+	return json.Marshal(entry)
+}
+
+func decodePost(raw []byte) (*store.Post, error) {
+	var entry cachedPost
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, err
+	}
+	post := &entry.Post
+	if len(entry.MediaKeys) != len(post.Attachments) || len(entry.VariantKeys) != len(post.Attachments) {
+		return nil, fmt.Errorf("cached post %d has %d attachments but %d keys", post.ID, len(post.Attachments), len(entry.MediaKeys))
+	}
+	for i := range post.Attachments {
+		media := &post.Attachments[i]
+		media.Key = entry.MediaKeys[i]
+		if len(entry.VariantKeys[i]) != len(media.Variants) {
+			return nil, fmt.Errorf("cached post %d has mismatched variant keys", post.ID)
+		}
+		for j := range media.Variants {
+			media.Variants[j].Key = entry.VariantKeys[i][j]
+		}
+	}
+	return post, nil
+}
+
+func (s *PostStore) GetByID(ctx context.Context, id int64, viewerId int64) (*store.Post, error) {
+	key := postKey(id)
+	if raw := get(ctx, s.cache, s.logger, key); raw != nil {
+		if post, err := decodePost(raw); err == nil {
+			visible, err := s.visible(ctx, post, viewerId)
+			if err != nil || !visible {
+				return nil, err
+			}
+			return post, nil
+		}
+	}
+	// misses are shared by viewer, a post one viewer may not see must not be
+	// handed to another
+	v, err, _ := s.group.Do(fmt.Sprintf("%s:%d", key, viewerId), func() (any, error) {
+		post, err := s.Posts.GetByID(context.WithoutCancel(ctx), id, viewerId)
+		if err != nil || post == nil {
+			return nil, err
+		}
+		raw, err := encodePost(post)
+		if err != nil {
+			return nil, err
+		}
+		if cacheable(post) {
+			set(ctx, s.cache, s.logger, key, raw, s.ttl)
+		}
+		return raw, nil
+	})
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return decodePost(v.([]byte))
+}
+
+// CanView answers from the cached post when there is one.
+func (s *PostStore) CanView(ctx context.Context, postID int64, viewerId int64) (bool, error) {
+	if raw := get(ctx, s.cache, s.logger, postKey(postID)); raw != nil {
+		if post, err := decodePost(raw); err == nil {
+			return s.visible(ctx, post, viewerId)
+		}
+	}
+	return s.Posts.CanView(ctx, postID, viewerId)
+}
+
+// visible tells whether viewerId may see the cached post, like
+// store.PostStore.CanView does in the database.
+func (s *PostStore) visible(ctx context.Context, post *store.Post, viewerId int64) (bool, error) {
+	if post.UserID == viewerId {
+		return true, nil
+	}
+	author, err := s.users.GetUserById(ctx, post.UserID)
+	if err != nil || author == nil {
+		return false, err
+	}
+	// anonymous viewers neither block nor follow anyone
+	var rel store.Relation
+	if viewerId != 0 {
+		if rel, err = s.followers.GetRelation(ctx, post.UserID, viewerId); err != nil {
+			return false, err
+		}
+	}
+	return store.PostVisible(post, author.IsPrivate, viewerId, rel), nil
+}
+
+// cacheable leaves out posts with attachments still being processed, which
+// change when their variants are made.
+func cacheable(post *store.Post) bool {
+	for _, media := range post.Attachments {
+		if media.Status == store.MediaPending {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *PostStore) Update(ctx context.Context, postID int64, post *store.Post) error {
+	if err := s.Posts.Update(ctx, postID, post); err != nil {
+		return err
+	}
+	invalidate(ctx, s.cache, s.logger, postKey(postID))
+	return nil
+}
+
+func (s *PostStore) Delete(ctx context.Context, postID int64) error {
+	if err := s.Posts.Delete(ctx, postID); err != nil {
+		return err
+	}
+	invalidate(ctx, s.cache, s.logger, postKey(postID))
+	return nil
+}
+
+// get returns the cached value of key, or nil. A failing cache is logged and
+// treated as a miss, requests are then served by the store.
+func get(ctx context.Context, cache Cache, logger *zap.SugaredLogger, key string) []byte {
+	raw, err := cache.Get(ctx, key)
+	if err != nil {
+		if err != ErrMiss {
+			logger.Warnw("cache get failed", "key", key, "error", err.Error())
+		}
+		return nil
+	}
+	return raw
+}
+
+func set(ctx context.Context, cache Cache, logger *zap.SugaredLogger, key string, value []byte, ttl time.Duration) {
+	if err := cache.Set(context.WithoutCancel(ctx), key, value, ttl); err != nil {
+		logger.Warnw("cache set failed", "key", key, "error", err.Error())
+	}
+}
+
+// invalidate removes entries right after the write that changed them. A read
+// that loaded the old row before the write committed may still store it, the
+// TTL bounds how long that lasts.
+func invalidate(ctx context.Context, cache Cache, logger *zap.SugaredLogger, keys ...string) {
+	if err := cache.Delete(context.WithoutCancel(ctx), keys...); err != nil {
+		logger.Errorw("cache invalidation failed, entries stay until they expire", "keys", keys, "error", err.Error())
+	}
+}
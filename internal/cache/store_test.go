@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// fakeStores stands in for the database behind the cached stores. Calls the
+// tests do not expect hit the nil embedded interfaces and panic.
+type fakeStores struct {
+	posts     map[int64]store.Post
+	users     map[int64]store.User
+	relations map[[2]int64]store.Relation
+	// requesters have a pending follow request to the private account
+	requesters []int64
+	queries    map[string]int
+}
+
+type fakePosts struct {
+	store.Posts
+	db *fakeStores
+}
+
+func (f fakePosts) GetByID(ctx context.Context, id int64, viewerId int64) (*store.Post, error) {
+	f.db.queries["GetByID"]++
+	post, ok := f.db.posts[id]
+	if !ok {
+		return nil, nil
+	}
+	return &post, nil
+}
+
+func (f fakePosts) CanView(ctx context.Context, postID int64, viewerId int64) (bool, error) {
+	f.db.queries["CanView"]++
+	return true, nil
+}
+
+type fakeUsers struct {
+	store.Users
+	db *fakeStores
+}
+
+func (f fakeUsers) GetUserById(ctx context.Context, id int64) (*store.User, error) {
+	f.db.queries["GetUserById"]++
+	user, ok := f.db.users[id]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// SetPrivate approves the requests of requesters when the account is made
+// public.
+func (f fakeUsers) SetPrivate(ctx context.Context, userId int64, private bool) ([]int64, error) {
+	user := f.db.users[userId]
+	user.IsPrivate = private
+	f.db.users[userId] = user
+	if private {
+		return nil, nil
+	}
+	approved := f.db.requesters
+	f.db.requesters = nil
+	for _, id := range approved {
+		f.db.relations[[2]int64{userId, id}] = store.Relation{Following: true}
+	}
+	return approved, nil
+}
+
+type fakeFollowers struct {
+	store.Followers
+	db *fakeStores
+}
+
+func (f fakeFollowers) GetRelation(ctx context.Context, userId int64, viewerId int64) (store.Relation, error) {
+	f.db.queries["GetRelation"]++
+	return f.db.relations[[2]int64{userId, viewerId}], nil
+}
+
+func (f fakeFollowers) UnFOllow(ctx context.Context, userId int64, unFOllowerId int64) error {
+	rel := f.db.relations[[2]int64{userId, unFOllowerId}]
+	rel.Following = false
+	f.db.relations[[2]int64{userId, unFOllowerId}] = rel
+	return nil
+}
+
+type fakeBlocks struct {
+	store.Blocks
+	db *fakeStores
+}
+
+func (f fakeBlocks) Block(ctx context.Context, blockerId, blockedId int64) error {
+	f.db.relations[[2]int64{blockerId, blockedId}] = store.Relation{Blocked: true}
+	f.db.relations[[2]int64{blockedId, blockerId}] = store.Relation{Blocked: true}
+	return nil
+}
+
+func newFakeCachedStores() (*fakeStores, *PostStore, *UserStore, *FollowerStore, *BlockStore) {
+	db := &fakeStores{
+		posts:     map[int64]store.Post{},
+		users:     map[int64]store.User{},
+		relations: map[[2]int64]store.Relation{},
+		queries:   map[string]int{},
+	}
+	cache := NewLRU(100)
+	logger := zap.NewNop().Sugar()
+	users := NewUserStore(fakeUsers{db: db}, cache, time.Minute, logger)
+	followers := NewFollowerStore(fakeFollowers{db: db}, cache, time.Minute, logger)
+	blocks := NewBlockStore(fakeBlocks{db: db}, cache, logger)
+	posts := NewPostStore(fakePosts{db: db}, users, followers, cache, time.Minute, logger)
+	return db, posts, users, followers, blocks
+}
+
+func TestPostStoreVisibility(t *testing.T) {
+	const author, viewer = 1, 2
+	tests := []struct {
+		name       string
+		visibility string
+		private    bool
+		rel        store.Relation
+		viewer     int64
+		want       bool
+	}{
+		{name: "public", visibility: store.VisibilityPublic, viewer: viewer, want: true},
+		{name: "public to anonymous", visibility: store.VisibilityPublic, viewer: 0, want: true},
+		{name: "unlisted", visibility: store.VisibilityUnlisted, viewer: viewer, want: true},
+		{name: "followers to stranger", visibility: store.VisibilityFollowers, viewer: viewer, want: false},
+		{name: "followers to follower", visibility: store.VisibilityFollowers, rel: store.Relation{Following: true}, viewer: viewer, want: true},
+		{name: "private", visibility: store.VisibilityPrivate, rel: store.Relation{Following: true}, viewer: viewer, want: false},
+		{name: "private to author", visibility: store.VisibilityPrivate, viewer: author, want: true},
+		{name: "private account to stranger", visibility: store.VisibilityPublic, private: true, viewer: viewer, want: false},
+		{name: "private account to anonymous", visibility: store.VisibilityPublic, private: true, viewer: 0, want: false},
+		{name: "private account to follower", visibility: store.VisibilityPublic, private: true, rel: store.Relation{Following: true}, viewer: viewer, want: true},
+		{name: "blocked", visibility: store.VisibilityPublic, rel: store.Relation{Blocked: true}, viewer: viewer, want: false},
+	}
+	for _, tt := range tests {
+		db, posts, _, _, _ := newFakeCachedStores()
+		db.posts[10] = store.Post{ID: 10, UserID: author, Visibility: tt.visibility}
+		db.users[author] = store.User{ID: author, IsActive: true, IsPrivate: tt.private}
+		db.relations[[2]int64{author, viewer}] = tt.rel
+
+		// the first read loads the post as the author, the second is a hit
+		if _, err := posts.GetByID(context.Background(), 10, author); err != nil {
+			t.Fatal(err)
+		}
+		for range 2 {
+			post, err := posts.GetByID(context.Background(), 10, tt.viewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := post != nil; got != tt.want {
+				t.Errorf("%s: visible = %v, want %v", tt.name, got, tt.want)
+			}
+			visible, err := posts.CanView(context.Background(), 10, tt.viewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if visible != tt.want {
+				t.Errorf("%s: CanView = %v, want %v", tt.name, visible, tt.want)
+			}
+		}
+		if db.queries["GetByID"] != 1 || db.queries["CanView"] != 0 || db.queries["GetUserById"] > 1 || db.queries["GetRelation"] > 1 {
+			t.Errorf("%s: hits queried the store: %v", tt.name, db.queries)
+		}
+	}
+}
+
+func TestPostStoreFollowsAndBlocks(t *testing.T) {
+	const author, viewer = 1, 2
+	ctx := context.Background()
+	db, posts, _, followers, blocks := newFakeCachedStores()
+	db.posts[10] = store.Post{ID: 10, UserID: author, Visibility: store.VisibilityFollowers}
+	db.posts[11] = store.Post{ID: 11, UserID: author, Visibility: store.VisibilityPublic}
+	db.users[author] = store.User{ID: author, IsActive: true}
+	db.relations[[2]int64{author, viewer}] = store.Relation{Following: true}
+
+	visible := func(id int64) bool {
+		t.Helper()
+		post, err := posts.GetByID(ctx, id, viewer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return post != nil
+	}
+	if !visible(10) || !visible(11) {
+		t.Fatal("a follower does not see the posts")
+	}
+	if err := followers.UnFOllow(ctx, author, viewer); err != nil {
+		t.Fatal(err)
+	}
+	if visible(10) {
+		t.Error("followers-only post still visible after unfollowing")
+	}
+	if !visible(11) {
+		t.Error("public post hidden after unfollowing")
+	}
+	if err := blocks.Block(ctx, viewer, author); err != nil {
+		t.Fatal(err)
+	}
+	if visible(11) {
+		t.Error("public post still visible after blocking")
+	}
+}
+
+func TestPostStoreMadePublic(t *testing.T) {
+	const author, requester, stranger = 1, 2, 3
+	ctx := context.Background()
+	db, posts, users, _, _ := newFakeCachedStores()
+	db.posts[10] = store.Post{ID: 10, UserID: author, Visibility: store.VisibilityFollowers}
+	db.users[author] = store.User{ID: author, IsActive: true, IsPrivate: true}
+	db.requesters = []int64{requester}
+
+	visible := func(viewer int64) bool {
+		t.Helper()
+		post, err := posts.GetByID(ctx, 10, viewer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return post != nil
+	}
+	// loads the post, then caches the relations of both
+	visible(author)
+	if visible(requester) || visible(stranger) {
+		t.Fatal("a followers-only post of a private account is visible before following")
+	}
+	if _, err := users.SetPrivate(ctx, author, false); err != nil {
+		t.Fatal(err)
+	}
+	if !visible(requester) {
+		t.Error("an approved requester does not see the followers-only post")
+	}
+	if visible(stranger) {
+		t.Error("a stranger sees the followers-only post")
+	}
+}
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"net/netip"
 	"time"
 
+	"github.com/likhon22/social/internal/blob"
+	"github.com/likhon22/social/internal/cache"
+	"github.com/likhon22/social/internal/jobs"
 	"github.com/likhon22/social/internal/mailer"
+	"github.com/likhon22/social/internal/ratelimit"
 )
 
 type DbConfig struct {
@@ -14,16 +19,84 @@ type DbConfig struct {
 }
 
 type AppConfig struct {
-	Addr    string
-	DB      *DbConfig
-	Version string
-	Env     string
-	ApiURL  string
-	Mail    *MailConfig
-	Mailer  mailer.Client
+	Addr        string
+	DB          *DbConfig
+	Version     string
+	Env         string
+	ApiURL      string
+	FrontendURL string
+	Mail        *MailConfig
+	Auth        *AuthConfig
+	Jobs        jobs.Config
+	Media       *MediaConfig
+	Cache       *CacheConfig
+	RateLimit   *RateLimitConfig
+	Redis       cache.RedisConfig
+	Metrics     *MetricsConfig
+	// AllowedOrigins are the origins of the pages, besides the API itself,
+	// that may open WebSocket streams.
+	AllowedOrigins []string
+	// TrustedProxies are the proxies in front of the API whose forwarding
+	// headers tell the address of the client.
+	TrustedProxies []netip.Prefix
+	// ShutdownTimeout is how long in-flight requests, streams and background
+	// jobs get to finish once the process is told to stop.
+	ShutdownTimeout time.Duration
 }
 
 type MailConfig struct {
-	Exp           time.Duration
-	MailGunConfig mailer.MailGunMailer
+	Exp              time.Duration
+	PasswordResetExp time.Duration
+	Provider         string // mailgun, smtp or outbox
+	MailGunConfig    mailer.MailGunMailer
+	SMTPConfig       mailer.SMTPMailer
+	OutboxDir        string
+}
+
+type MediaConfig struct {
+	Provider  string // local or s3
+	MaxSize   int64
+	URLExp    time.Duration
+	LocalDir  string
+	LocalURL  string
+	URLSecret string
+	S3        blob.S3Config
+}
+
+// CacheConfig sets up the cache of users and posts read by ID. The memory
+// cache is only invalidated in its own process, run several instances with
+// redis.
+type CacheConfig struct {
+	Provider string // memory, redis or none
+	Size     int
+	UserTTL  time.Duration
+	PostTTL  time.Duration
+}
+
+// RateLimitConfig sets up the limits on requests. Policies are looked up by
+// the name the routes use. The memory store counts per instance, run several
+// instances with redis.
+type RateLimitConfig struct {
+	Enabled  bool
+	Store    string // memory or redis
+	Policies map[string]ratelimit.Policy
+}
+
+type AuthConfig struct {
+	Token TokenConfig
+}
+
+type TokenConfig struct {
+	Secret     string
+	Exp        time.Duration
+	RefreshExp time.Duration
+	Iss        string
+}
+
+// MetricsConfig controls the Prometheus metrics served on /metrics. They are
+// served on Addr, apart from the API, so that they can be kept off the public
+// network.
+type MetricsConfig struct {
+	Enabled bool
+	Addr    string
 }
@@ -0,0 +1,73 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func fill(w, h int, f func(x, y int) color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, f(x, y))
+		}
+	}
+	return img
+}
+
+// The expected hashes were computed with a line by line port of the reference
+// encoder, https://github.com/woltapp/blurhash, for the same pixels. The one of
+// black is the well-known hash of a black image. The basis functions do not
+// cancel out over the image, so even solid colours other than black have AC
+// components.
+func TestBlurhash(t *testing.T) {
+	tests := []struct {
+		name   string
+		img    *image.RGBA
+		nx, ny int
+		want   string
+	}{
+		{"black", fill(8, 6, func(x, y int) color.RGBA { return color.RGBA{0, 0, 0, 255} }), 4, 3, "L00000fQfQfQfQfQfQfQfQfQfQfQ"},
+		{"white", fill(8, 6, func(x, y int) color.RGBA { return color.RGBA{255, 255, 255, 255} }), 4, 3, "LsTSUA_3fQ_3~qt7fQt7fQfQfQfQ"},
+		{"gradient", fill(8, 6, func(x, y int) color.RGBA {
+			return color.RGBA{uint8(x * 32), uint8(y * 40), uint8(255 - x*16 - y*10), 255}
+		}), 4, 3, "L$F=b87Qb2xdvHR=fSnneuf9fRf8"},
+		{"red and blue halves", fill(8, 6, func(x, y int) color.RGBA {
+			if x < 4 {
+				return color.RGBA{255, 0, 0, 255}
+			}
+			return color.RGBA{0, 0, 255, 255}
+		}), 4, 3, "L~LjfL|T,SST$A$1sRb0fQfQfQfQ"},
+		// the DC component only
+		{"one component", fill(8, 6, func(x, y int) color.RGBA {
+			if x < 4 {
+				return color.RGBA{255, 0, 0, 255}
+			}
+			return color.RGBA{0, 0, 255, 255}
+		}), 1, 1, "00LjfL"},
+	}
+	for _, tt := range tests {
+		if got := Blurhash(tt.img, tt.nx, tt.ny); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncode83(t *testing.T) {
+	tests := []struct {
+		value, length int
+		want          string
+	}{
+		{0, 1, "0"},
+		{82, 1, "~"},
+		{83, 2, "10"},
+		{3429, 2, "fQ"},
+		{83*83*83*83 - 1, 4, "~~~~"},
+	}
+	for _, tt := range tests {
+		if got := encode83(tt.value, tt.length); got != tt.want {
+			t.Errorf("encode83(%d, %d) = %q, want %q", tt.value, tt.length, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package imaging turns uploaded images into sanitized originals, resized
+// variants and blurhash placeholders, using only the standard library codecs.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// MaxPixels caps the decoded size of an image, so small files that decode
+// into huge bitmaps are rejected before decoding. Processing holds the decoded
+// image, its RGBA copy and the rotated one at once, up to 12 bytes a pixel, and
+// a job worker may process an image each: 16 megapixels, what most phone
+// cameras take, stay under 200MB a worker.
+const MaxPixels = 16_000_000
+
+var (
+	ErrUnsupported = errors.New("unsupported image format")
+	ErrTooLarge    = errors.New("image is too large")
+)
+
+type Size struct {
+	Name string
+	// Max is the longest side of the variant in pixels.
+	Max int
+}
+
+// Sizes are the variants made for every image. Sizes the original is not
+// larger than are skipped.
+var Sizes = []Size{
+	{Name: "thumb", Max: 160},
+	{Name: "small", Max: 480},
+	{Name: "medium", Max: 1080},
+}
+
+type Variant struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+type Result struct {
+	Width    int
+	Height   int
+	Blurhash string
+	// Original is the image without its metadata, nil when the upload can be
+	// kept as it is.
+	Original []byte
+	Variants []Variant
+}
+
+// Process decodes a JPEG, PNG or GIF image and builds its derivatives. JPEG and
+// PNG originals are re-encoded, which drops EXIF, GPS and text metadata. JPEGs
+// are rotated upright first, since their orientation tag is dropped with the
+// rest. GIFs carry no EXIF and are kept as they are to preserve animation.
+func Process(data []byte) (*Result, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	img := toRGBA(src)
+
+	res := &Result{}
+	switch format {
+	case "jpeg":
+		img = orient(img, jpegOrientation(data))
+		if res.Original, err = encode(img, "jpeg", 90); err != nil {
+			return nil, err
+		}
+	case "png":
+		if res.Original, err = encode(img, "png", 0); err != nil {
+			return nil, err
+		}
+	case "gif":
+	default:
+		return nil, ErrUnsupported
+	}
+	bounds := img.Bounds()
+	res.Width, res.Height = bounds.Dx(), bounds.Dy()
+
+	// variants of GIFs are still images of the first frame
+	variantFormat := format
+	if format == "gif" {
+		variantFormat = "png"
+	}
+	for _, size := range Sizes {
+		if res.Width <= size.Max && res.Height <= size.Max {
+			continue
+		}
+		w, h := fit(res.Width, res.Height, size.Max)
+		b, err := encode(resize(img, w, h), variantFormat, 80)
+		if err != nil {
+			return nil, err
+		}
+		res.Variants = append(res.Variants, Variant{
+			Name:        size.Name,
+			Width:       w,
+			Height:      h,
+			ContentType: "image/" + variantFormat,
+			Data:        b,
+		})
+	}
+
+	w, h := fit(res.Width, res.Height, 32)
+	res.Blurhash = Blurhash(resize(img, w, h), 4, 3)
+	return res, nil
+}
+
+// fit scales w x h down so that its longest side is max.
+func fit(w, h, max int) (int, int) {
+	if w >= h {
+		return max, maxInt(1, h*max/w)
+	}
+	return maxInt(1, w*max/h), max
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		err = ErrUnsupported
+	}
+	return buf.Bytes(), err
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	if img, ok := src.(*image.RGBA); ok && img.Bounds().Min == (image.Point{}) {
+		return img
+	}
+	b := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(img, img.Bounds(), src, b.Min, draw.Src)
+	return img
+}
+
+// resize scales src down to w x h by averaging the source pixels that fall on
+// each target pixel.
+func resize(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, maxInt((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, maxInt((x+1)*sw/w, x*sw/w+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,216 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halves is a w x h image, red on the left half and blue on the right.
+func halves(w, h int) *image.RGBA {
+	return fill(w, h, func(x, y int) color.RGBA {
+		if x < w/2 {
+			return color.RGBA{255, 0, 0, 255}
+		}
+		return color.RGBA{0, 0, 255, 255}
+	})
+}
+
+func encodeTest(t *testing.T, img image.Image, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngChunk builds a PNG chunk with its checksum.
+func pngChunk(kind string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	b = append(b, kind...)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[4:]))
+}
+
+func decode(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xc000 && g < 0x4000 && b < 0x4000
+}
+
+func isBlue(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r < 0x4000 && g < 0x4000 && b > 0xc000
+}
+
+func TestProcessRotatesJPEG(t *testing.T) {
+	// stored sideways, the camera was turned by 90° clockwise
+	data := withExif(encodeTest(t, halves(64, 32), "jpeg"), tiff(binary.BigEndian, 8, [2]uint16{0x0112, 6}))
+	res, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Width != 32 || res.Height != 64 {
+		t.Fatalf("got %dx%d, want 32x64", res.Width, res.Height)
+	}
+	img := decode(t, res.Original)
+	if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 64 {
+		t.Fatalf("the original is %dx%d, want 32x64", b.Dx(), b.Dy())
+	}
+	// the left half is on top once upright
+	if !isRed(img.At(16, 8)) || !isBlue(img.At(16, 56)) {
+		t.Errorf("the original is not upright, top %v and bottom %v", img.At(16, 8), img.At(16, 56))
+	}
+}
+
+func TestProcessStripsJPEGMetadata(t *testing.T) {
+	exif := append(tiff(binary.BigEndian, 8, [2]uint16{0x0112, 1}), "GPS 52.5200N 13.4050E"...)
+	res, err := Process(withExif(encodeTest(t, halves(64, 32), "jpeg"), exif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(res.Original, []byte("Exif")) || bytes.Contains(res.Original, []byte("GPS")) {
+		t.Error("the original still carries the EXIF segment")
+	}
+	if jpegOrientation(res.Original) != 1 {
+		t.Error("the original still carries an orientation")
+	}
+}
+
+func TestProcessStripsPNGMetadata(t *testing.T) {
+	data := encodeTest(t, halves(64, 32), "png")
+	// a text chunk right after the header chunk, which is 8 + 25 bytes
+	text := pngChunk("tEXt", []byte("Location\x0052.5200N 13.4050E"))
+	data = append(append(append([]byte{}, data[:33]...), text...), data[33:]...)
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("the test image is invalid: %v", err)
+	}
+
+	res, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(res.Original, []byte("tEXt")) || bytes.Contains(res.Original, []byte("52.5200N")) {
+		t.Error("the original still carries the text chunk")
+	}
+	if !isRed(decode(t, res.Original).At(8, 16)) {
+		t.Error("the original lost its pixels")
+	}
+}
+
+func TestProcessKeepsGIF(t *testing.T) {
+	res, err := Process(encodeTest(t, halves(600, 300), "gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Original != nil {
+		t.Error("the GIF was re-encoded")
+	}
+	for _, v := range res.Variants {
+		if v.ContentType != "image/png" {
+			t.Errorf("%s: got content type %s, want image/png", v.Name, v.ContentType)
+		}
+	}
+}
+
+func TestProcessVariants(t *testing.T) {
+	res, err := Process(encodeTest(t, halves(600, 300), "png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// medium is larger than the original and skipped
+	want := []Variant{
+		{Name: "thumb", Width: 160, Height: 80, ContentType: "image/png"},
+		{Name: "small", Width: 480, Height: 240, ContentType: "image/png"},
+	}
+	if len(res.Variants) != len(want) {
+		t.Fatalf("got %d variants, want %d", len(res.Variants), len(want))
+	}
+	for i, v := range res.Variants {
+		w := want[i]
+		if v.Name != w.Name || v.Width != w.Width || v.Height != w.Height || v.ContentType != w.ContentType {
+			t.Errorf("got variant %s %dx%d %s, want %s %dx%d %s", v.Name, v.Width, v.Height, v.ContentType, w.Name, w.Width, w.Height, w.ContentType)
+		}
+		if b := decode(t, v.Data).Bounds(); b.Dx() != w.Width || b.Dy() != w.Height {
+			t.Errorf("%s: the data is %dx%d", v.Name, b.Dx(), b.Dy())
+		}
+	}
+	if len(res.Blurhash) != 28 {
+		t.Errorf("got blurhash %q, want 4x3 components", res.Blurhash)
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	// a valid header for a huge image, which is refused before decoding
+	ihdr := binary.BigEndian.AppendUint32(nil, 5000)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 5000)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	huge := append([]byte("\x89PNG\r\n\x1a\n"), pngChunk("IHDR", ihdr)...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"too large", huge, ErrTooLarge},
+		{"not an image", []byte("hello"), ErrUnsupported},
+		{"truncated", encodeTest(t, halves(64, 32), "jpeg")[:200], ErrUnsupported},
+	}
+	for _, tt := range tests {
+		if _, err := Process(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestProcessMalformedExif(t *testing.T) {
+	exif := tiff(binary.LittleEndian, 8, [2]uint16{0x0112, 6})
+	binary.LittleEndian.PutUint32(exif[4:], 0xfffffff0)
+	res, err := Process(withExif(encodeTest(t, halves(64, 32), "jpeg"), exif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Width != 64 || res.Height != 32 {
+		t.Errorf("got %dx%d, want the image as stored", res.Width, res.Height)
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct{ w, h, max, wantW, wantH int }{
+		{600, 300, 160, 160, 80},
+		{300, 600, 160, 80, 160},
+		{100, 100, 32, 32, 32},
+		// never below a pixel
+		{10000, 1, 32, 32, 1},
+	}
+	for _, tt := range tests {
+		if w, h := fit(tt.w, tt.h, tt.max); w != tt.wantW || h != tt.wantH {
+			t.Errorf("fit(%d, %d, %d) = %d, %d, want %d, %d", tt.w, tt.h, tt.max, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
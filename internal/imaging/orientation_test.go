@@ -0,0 +1,176 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+// labelled is a w x h image whose pixels carry their index in the red
+// channel.
+func labelled(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < w*h; i++ {
+		img.Pix[i*4] = uint8(i)
+		img.Pix[i*4+3] = 0xff
+	}
+	return img
+}
+
+func labels(img *image.RGBA) []uint8 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	out := make([]uint8, 0, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out = append(out, img.Pix[y*img.Stride+x*4])
+		}
+	}
+	return out
+}
+
+func TestOrient(t *testing.T) {
+	// the stored image is
+	//   0 1 2
+	//   3 4 5
+	// and each orientation tells how to turn it upright
+	tests := []struct {
+		orientation int
+		w, h        int
+		want        []uint8
+	}{
+		{1, 3, 2, []uint8{0, 1, 2, 3, 4, 5}},
+		// mirrored horizontally
+		{2, 3, 2, []uint8{2, 1, 0, 5, 4, 3}},
+		// rotated by 180°
+		{3, 3, 2, []uint8{5, 4, 3, 2, 1, 0}},
+		// mirrored vertically
+		{4, 3, 2, []uint8{3, 4, 5, 0, 1, 2}},
+		// transposed
+		{5, 2, 3, []uint8{0, 3, 1, 4, 2, 5}},
+		// rotated by 90° clockwise
+		{6, 2, 3, []uint8{3, 0, 4, 1, 5, 2}},
+		// transversed
+		{7, 2, 3, []uint8{5, 2, 4, 1, 3, 0}},
+		// rotated by 90° counterclockwise
+		{8, 2, 3, []uint8{2, 5, 1, 4, 0, 3}},
+		// out of range, kept as it is
+		{0, 3, 2, []uint8{0, 1, 2, 3, 4, 5}},
+		{9, 3, 2, []uint8{0, 1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		got := orient(labelled(3, 2), tt.orientation)
+		if w, h := got.Bounds().Dx(), got.Bounds().Dy(); w != tt.w || h != tt.h {
+			t.Errorf("orientation %d: got %dx%d, want %dx%d", tt.orientation, w, h, tt.w, tt.h)
+			continue
+		}
+		if l := labels(got); string(l) != string(tt.want) {
+			t.Errorf("orientation %d: got %v, want %v", tt.orientation, l, tt.want)
+		}
+	}
+}
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiff builds a TIFF header in order whose first IFD, at offset ifd, holds
+// entries. Each entry is a tag with a short value.
+func tiff(order byteOrder, ifd uint32, entries ...[2]uint16) []byte {
+	b := []byte("MM")
+	if order == binary.LittleEndian {
+		b = []byte("II")
+	}
+	b = order.AppendUint16(b, 42)
+	b = order.AppendUint32(b, ifd)
+	for len(b) < int(ifd) {
+		b = append(b, 0)
+	}
+	b = order.AppendUint16(b, uint16(len(entries)))
+	for _, e := range entries {
+		b = order.AppendUint16(b, e[0])
+		// type SHORT, count 1, the value left-aligned in the 4 bytes
+		b = order.AppendUint16(b, 3)
+		b = order.AppendUint32(b, 1)
+		b = order.AppendUint16(b, e[1])
+		b = order.AppendUint16(b, 0)
+	}
+	// no next IFD
+	return order.AppendUint32(b, 0)
+}
+
+// withExif inserts an APP1 segment with the TIFF data right after the start
+// of image marker of a JPEG.
+func withExif(jpg, tiffData []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), tiffData...)
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, 0xff, 0xe1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+// soi is the start of a JPEG without image data, enough for the metadata
+// parser.
+var soi = []byte{0xff, 0xd8}
+
+func TestJPEGOrientation(t *testing.T) {
+	for o := uint16(1); o <= 8; o++ {
+		for _, order := range []byteOrder{binary.BigEndian, binary.LittleEndian} {
+			data := withExif(soi, tiff(order, 8, [2]uint16{0x0100, 640}, [2]uint16{0x0112, o}))
+			if got := jpegOrientation(data); got != int(o) {
+				t.Errorf("orientation %d, %v: got %d", o, order, got)
+			}
+		}
+	}
+}
+
+func TestJPEGOrientationMalformed(t *testing.T) {
+	valid := tiff(binary.BigEndian, 8, [2]uint16{0x0112, 6})
+	outOfRange := tiff(binary.BigEndian, 8, [2]uint16{0x0112, 6})
+	binary.BigEndian.PutUint32(outOfRange[4:], 0xfffffff0)
+	manyEntries := tiff(binary.BigEndian, 8, [2]uint16{0x0100, 1})
+	binary.BigEndian.PutUint16(manyEntries[8:], 0xffff)
+	tooLongSegment := withExif(soi, valid)
+	binary.BigEndian.PutUint16(tooLongSegment[4:], 0xffff)
+	shortSegment := withExif(soi, valid)
+	binary.BigEndian.PutUint16(shortSegment[4:], 1)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n")},
+		{"no segments", soi},
+		{"garbage after the start", []byte{0xff, 0xd8, 0x00, 0x01, 0x02, 0x03}},
+		{"segment longer than the file", tooLongSegment},
+		{"segment length below 2", shortSegment},
+		{"truncated TIFF header", withExif(soi, valid[:6])},
+		{"unknown byte order", withExif(soi, append([]byte("XX"), valid[2:]...))},
+		{"IFD offset past the end", withExif(soi, outOfRange)},
+		{"IFD offset at the end", withExif(soi, valid[:8])},
+		{"more entries than data", withExif(soi, manyEntries)},
+		{"truncated entry", withExif(soi, valid[:len(valid)-10])},
+		{"orientation out of range", withExif(soi, tiff(binary.BigEndian, 8, [2]uint16{0x0112, 9}))},
+		{"orientation 0", withExif(soi, tiff(binary.LittleEndian, 8, [2]uint16{0x0112, 0}))},
+		{"image data before the metadata", append([]byte{0xff, 0xd8, 0xff, 0xda, 0x00, 0x02}, withExif(soi, valid)[2:]...)},
+	}
+	for _, tt := range tests {
+		if got := jpegOrientation(tt.data); got != 1 {
+			t.Errorf("%s: got orientation %d, want 1", tt.name, got)
+		}
+	}
+}
+
+func FuzzJPEGOrientation(f *testing.F) {
+	f.Add(withExif(soi, tiff(binary.BigEndian, 8, [2]uint16{0x0112, 6})))
+	f.Add(withExif(soi, tiff(binary.LittleEndian, 20, [2]uint16{0x0100, 1}, [2]uint16{0x0112, 3})))
+	f.Add(withExif(soi, []byte("II*\x00\xff\xff\xff\xff")))
+	f.Add([]byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x02})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if o := jpegOrientation(data); o < 1 || o > 8 {
+			t.Errorf("got orientation %d", o)
+		}
+	})
+}
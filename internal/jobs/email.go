@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/likhon22/social/internal/mailer"
+	"github.com/likhon22/social/internal/store"
+)
+
+const KindSendEmail = "send_email"
+
+type EmailPayload struct {
+	Template  string         `json:"template"`
+	Username  string         `json:"username"`
+	Email     string         `json:"email"`
+	Data      map[string]any `json:"data"`
+	IsSandbox bool           `json:"is_sandbox"`
+}
+
+// NewEmailMessage builds an outbox message that sends the given template.
+func NewEmailMessage(payload EmailPayload) (*store.OutboxMessage, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &store.OutboxMessage{Kind: KindSendEmail, Payload: b}, nil
+}
+
+func SendEmailHandler(client mailer.Client) Handler {
+	return func(ctx context.Context, raw json.RawMessage) error {
+		var payload EmailPayload
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return err
+		}
+		return client.Send(payload.Template, payload.Username, payload.Email, payload.Data, payload.IsSandbox)
+	}
+}
@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Handler processes the payload of a single outbox message. Returning an
+// error schedules a retry.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+type Config struct {
+	Workers      int
+	BatchSize    int
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	// Lease is how long a claimed message may stay in processing before
+	// another worker picks it up again.
+	Lease time.Duration
+}
+
+type Pool struct {
+	cfg      Config
+	outbox   store.Outbox
+	logger   *zap.SugaredLogger
+	handlers map[string]Handler
+	wg       sync.WaitGroup
+}
+
+func NewPool(cfg Config, outbox store.Outbox, logger *zap.SugaredLogger) *Pool {
+	return &Pool{
+		cfg:      cfg,
+		outbox:   outbox,
+		logger:   logger,
+		handlers: map[string]Handler{},
+	}
+}
+
+// Register sets the handler for messages of the given kind. It must be called
+// before Run.
+func (p *Pool) Register(kind string, h Handler) {
+	p.handlers[kind] = h
+}
+
+// Run polls the outbox and hands claimed messages to the workers until ctx is
+// cancelled. It returns once every in-flight message has been processed.
+func (p *Pool) Run(ctx context.Context) {
+	queue := make(chan store.OutboxMessage)
+	for i := 0; i < p.cfg.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for msg := range queue {
+				p.process(msg)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		messages, err := p.outbox.Claim(ctx, p.cfg.BatchSize, p.cfg.Lease)
+		if err != nil && ctx.Err() == nil {
+			p.logger.Errorw("error claiming outbox messages", "error", err)
+		}
+		for _, msg := range messages {
+			queue <- msg
+		}
+		// keep draining while there is a backlog
+		if len(messages) == p.cfg.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			close(queue)
+			p.wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pool) process(msg store.OutboxMessage) {
+	// claimed messages are finished even when the pool is stopping
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Lease)
+	defer cancel()
+
+	err := p.handle(ctx, msg)
+	if err == nil {
+		if err := p.outbox.Complete(ctx, msg.ID); err != nil {
+			p.logger.Errorw("error completing outbox message", "error", err, "id", msg.ID)
+		}
+		return
+	}
+
+	if msg.Attempts >= p.cfg.MaxAttempts {
+		p.logger.Errorw("outbox message moved to dead letters", "error", err, "id", msg.ID, "kind", msg.Kind, "attempts", msg.Attempts)
+		if err := p.outbox.DeadLetter(ctx, msg.ID, err.Error()); err != nil {
+			p.logger.Errorw("error dead lettering outbox message", "error", err, "id", msg.ID)
+		}
+		return
+	}
+
+	runAt := time.Now().Add(p.backoff(msg.Attempts))
+	p.logger.Warnw("outbox message failed, retrying", "error", err, "id", msg.ID, "kind", msg.Kind, "attempts", msg.Attempts, "run_at", runAt)
+	if err := p.outbox.Retry(ctx, msg.ID, err.Error(), runAt); err != nil {
+		p.logger.Errorw("error scheduling outbox retry", "error", err, "id", msg.ID)
+	}
+}
+
+func (p *Pool) handle(ctx context.Context, msg store.OutboxMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	h, ok := p.handlers[msg.Kind]
+	if !ok {
+		return fmt.Errorf("no handler registered for %q", msg.Kind)
+	}
+	return h(ctx, msg.Payload)
+}
+
+// backoff doubles BaseBackoff for every failed attempt, up to MaxBackoff.
+func (p *Pool) backoff(attempts int) time.Duration {
+	d := p.cfg.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= p.cfg.MaxBackoff {
+			return p.cfg.MaxBackoff
+		}
+	}
+	return d
+}
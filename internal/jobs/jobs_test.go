@@ -0,0 +1,216 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// memoryOutbox is an outbox of the messages given to it, which tracks what the
+// pool did with each.
+type memoryOutbox struct {
+	mu         sync.Mutex
+	pending    []store.OutboxMessage
+	claims     map[int64]int
+	completed  []int64
+	retried    map[int64]time.Time
+	deadLetter map[int64]string
+}
+
+func newMemoryOutbox(messages ...store.OutboxMessage) *memoryOutbox {
+	return &memoryOutbox{
+		pending:    messages,
+		claims:     map[int64]int{},
+		retried:    map[int64]time.Time{},
+		deadLetter: map[int64]string{},
+	}
+}
+
+func (o *memoryOutbox) Enqueue(ctx context.Context, msg *store.OutboxMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pending = append(o.pending, *msg)
+	return nil
+}
+
+func (o *memoryOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]store.OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := min(limit, len(o.pending))
+	claimed := o.pending[:n]
+	o.pending = o.pending[n:]
+	for i := range claimed {
+		claimed[i].Attempts++
+		o.claims[claimed[i].ID]++
+	}
+	return claimed, nil
+}
+
+func (o *memoryOutbox) Complete(ctx context.Context, id int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.completed = append(o.completed, id)
+	return nil
+}
+
+func (o *memoryOutbox) Retry(ctx context.Context, id int64, lastErr string, runAt time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.retried[id] = runAt
+	return nil
+}
+
+func (o *memoryOutbox) DeadLetter(ctx context.Context, id int64, lastErr string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.deadLetter[id] = lastErr
+	return nil
+}
+
+var testConfig = Config{
+	Workers:      3,
+	BatchSize:    4,
+	PollInterval: time.Millisecond,
+	MaxAttempts:  3,
+	BaseBackoff:  time.Second,
+	MaxBackoff:   time.Minute,
+	Lease:        time.Second,
+}
+
+// runUntil runs p until every message of outbox was handled one way or another.
+func runUntil(t *testing.T, p *Pool, outbox *memoryOutbox, handled int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		outbox.mu.Lock()
+		n := len(outbox.completed) + len(outbox.retried) + len(outbox.deadLetter)
+		outbox.mu.Unlock()
+		if n >= handled {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("handled %d of %d messages", n, handled)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+}
+
+func TestPoolClaimsEachMessageOnce(t *testing.T) {
+	var messages []store.OutboxMessage
+	for i := range 25 {
+		messages = append(messages, store.OutboxMessage{ID: int64(i + 1), Kind: "ok"})
+	}
+	outbox := newMemoryOutbox(messages...)
+	p := NewPool(testConfig, outbox, zap.NewNop().Sugar())
+	p.Register("ok", func(ctx context.Context, payload json.RawMessage) error {
+		return nil
+	})
+	runUntil(t, p, outbox, len(messages))
+
+	if len(outbox.completed) != len(messages) {
+		t.Errorf("completed %d of %d messages", len(outbox.completed), len(messages))
+	}
+	for id, n := range outbox.claims {
+		if n != 1 {
+			t.Errorf("message %d claimed %d times", id, n)
+		}
+	}
+	if len(outbox.retried) != 0 || len(outbox.deadLetter) != 0 {
+		t.Errorf("retried %v, dead lettered %v", outbox.retried, outbox.deadLetter)
+	}
+}
+
+func TestPoolRetriesFailures(t *testing.T) {
+	outbox := newMemoryOutbox(
+		store.OutboxMessage{ID: 1, Kind: "failing"},
+		store.OutboxMessage{ID: 2, Kind: "failing", Attempts: 1},
+		store.OutboxMessage{ID: 3, Kind: "panicking"},
+		store.OutboxMessage{ID: 4, Kind: "unknown"},
+		store.OutboxMessage{ID: 5, Kind: "failing", Attempts: 2},
+	)
+	p := NewPool(testConfig, outbox, zap.NewNop().Sugar())
+	p.Register("failing", func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("failed")
+	})
+	p.Register("panicking", func(ctx context.Context, payload json.RawMessage) error {
+		panic("oops")
+	})
+	start := time.Now()
+	runUntil(t, p, outbox, 5)
+
+	// the first attempt waits BaseBackoff, the second twice that
+	for id, want := range map[int64]time.Duration{1: time.Second, 2: 2 * time.Second, 3: time.Second, 4: time.Second} {
+		runAt, ok := outbox.retried[id]
+		if !ok {
+			t.Errorf("message %d was not retried", id)
+			continue
+		}
+		if got := runAt.Sub(start); got < want || got > want+time.Second {
+			t.Errorf("message %d retried in %v, want %v", id, got, want)
+		}
+	}
+	// the third attempt was the last
+	if got := outbox.deadLetter[5]; got != "failed" {
+		t.Errorf("message 5 dead lettered with %q, want failed", got)
+	}
+	if len(outbox.completed) != 0 {
+		t.Errorf("completed %v", outbox.completed)
+	}
+}
+
+// TestPoolFinishesClaimedMessages checks a stopping pool still handles the
+// messages it claimed, rather than leaving them locked until the lease ends.
+func TestPoolFinishesClaimedMessages(t *testing.T) {
+	outbox := newMemoryOutbox(store.OutboxMessage{ID: 1, Kind: "slow"})
+	p := NewPool(testConfig, outbox, zap.NewNop().Sugar())
+	started := make(chan struct{})
+	p.Register("slow", func(ctx context.Context, payload json.RawMessage) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+	<-started
+	cancel()
+	<-done
+
+	if len(outbox.completed) != 1 {
+		t.Errorf("completed %v, want the claimed message", outbox.completed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := NewPool(Config{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second}, nil, nil)
+	for attempts, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+		9: 10 * time.Second,
+	} {
+		if got := p.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/likhon22/social/internal/blob"
+	"github.com/likhon22/social/internal/imaging"
+	"github.com/likhon22/social/internal/store"
+)
+
+const KindProcessMedia = "process_media"
+
+// ProcessedMediaTypes are the uploads ProcessMediaHandler makes variants of.
+var ProcessedMediaTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+type MediaPayload struct {
+	Key string `json:"key"`
+}
+
+// NewProcessMediaMessage builds an outbox message that processes the upload
+// stored under key.
+func NewProcessMediaMessage(key string) (*store.OutboxMessage, error) {
+	b, err := json.Marshal(MediaPayload{Key: key})
+	if err != nil {
+		return nil, err
+	}
+	return &store.OutboxMessage{Kind: KindProcessMedia, Payload: b}, nil
+}
+
+// ProcessMediaHandler replaces an uploaded image by a copy without metadata,
+// stores its resized variants next to it and records them with the media.
+// Images that cannot be decoded are marked failed instead of retried.
+func ProcessMediaHandler(uploads store.Uploads, blobs blob.BlobStore) Handler {
+	return func(ctx context.Context, raw json.RawMessage) error {
+		var payload MediaPayload
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return err
+		}
+		media, err := uploads.GetByKey(ctx, payload.Key)
+		if err != nil {
+			return err
+		}
+		// the upload was deleted in the meantime
+		if media == nil {
+			return nil
+		}
+
+		body, err := blobs.Get(ctx, media.Key)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+
+		res, err := imaging.Process(data)
+		if err != nil {
+			if errors.Is(err, imaging.ErrUnsupported) || errors.Is(err, imaging.ErrTooLarge) {
+				return uploads.SetFailed(ctx, media.ID)
+			}
+			return err
+		}
+
+		if res.Original != nil {
+			if err := blobs.Put(ctx, media.Key, bytes.NewReader(res.Original), int64(len(res.Original)), media.ContentType); err != nil {
+				return err
+			}
+			media.Size = int64(len(res.Original))
+		}
+		base := strings.TrimSuffix(media.Key, path.Ext(media.Key))
+		media.Variants = make([]store.MediaVariant, 0, len(res.Variants))
+		for _, v := range res.Variants {
+			variant := store.MediaVariant{
+				Name:        v.Name,
+				Key:         base + "_" + v.Name + "." + strings.TrimPrefix(v.ContentType, "image/"),
+				Width:       v.Width,
+				Height:      v.Height,
+				ContentType: v.ContentType,
+				Size:        int64(len(v.Data)),
+			}
+			if err := blobs.Put(ctx, variant.Key, bytes.NewReader(v.Data), variant.Size, v.ContentType); err != nil {
+				return err
+			}
+			media.Variants = append(media.Variants, variant)
+		}
+		media.Width, media.Height, media.Blurhash = res.Width, res.Height, res.Blurhash
+		return uploads.SetProcessed(ctx, media)
+	}
+}
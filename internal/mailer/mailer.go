@@ -1,5 +1,20 @@
 package mailer
 
+import (
+	"bytes"
+	"embed"
+	"html/template"
+)
+
+const (
+	FromName              = "GoSocial"
+	UserWelcomeTemplate   = "user_invitation.tmpl"
+	PasswordResetTemplate = "password_reset.tmpl"
+)
+
+//go:embed "templates"
+var FS embed.FS
+
 type Client interface {
 	Send(templateFile, username, email string, data any, isSandbox bool) error
 }
@@ -15,3 +30,21 @@ func NewClient(apiKey, from string) *Mailer {
 		},
 	}
 }
+
+// renderTemplate executes the "subject" and "body" blocks of an embedded
+// template file.
+func renderTemplate(templateFile string, data any) (string, string, error) {
+	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+	if err != nil {
+		return "", "", err
+	}
+	subject := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return "", "", err
+	}
+	body := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(body, "body", data); err != nil {
+		return "", "", err
+	}
+	return subject.String(), body.String(), nil
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	SentAt  time.Time
+}
+
+// OutboxMailer writes every rendered message to a file in Dir instead of
+// delivering it, or drops it when Dir is empty. It is meant for local
+// development, nothing ever reaches the recipients.
+type OutboxMailer struct {
+	Dir string
+}
+
+func NewOutbox(dir string) *OutboxMailer {
+	return &OutboxMailer{Dir: dir}
+}
+
+func (o *OutboxMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+	subject, body, err := renderTemplate(templateFile, data)
+	if err != nil {
+		return err
+	}
+	msg := Message{
+		To:      email,
+		Subject: subject,
+		Body:    body,
+		SentAt:  time.Now(),
+	}
+
+	if o.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(o.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d_%s.html", msg.SentAt.UnixNano(), email)
+	return os.WriteFile(filepath.Join(o.Dir, name), []byte(body), 0o644)
+}
@@ -2,6 +2,7 @@ package mailer
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	mailgun "github.com/mailgun/mailgun-go/v4"
@@ -16,18 +17,27 @@ type MailGunMailer struct {
 func NewSendGrind(apiKey, from string) *MailGunMailer {
 	client := mailgun.NewMailgun("sandbox4b7c75e350f94c55b3e2b4d065bb126b.mailgun.org", apiKey)
 	return &MailGunMailer{
-		FromEmail: "test@sandbox4b7c75e350f94c55b3e2b4d065bb126b.mailgun.org",
+		FromEmail: from,
 		APIKey:    apiKey,
 		Client:    client,
 	}
 }
 
 func (s *MailGunMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+	subject, body, err := renderTemplate(templateFile, data)
+	if err != nil {
+		return err
+	}
 
-	message := mailgun.NewMessage(s.FromEmail, "", "", email)
+	from := fmt.Sprintf("%s <%s>", FromName, s.FromEmail)
+	message := mailgun.NewMessage(from, subject, "", email)
+	message.SetHtml(body)
+	if isSandbox {
+		message.EnableTestMode()
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
-	_, _, err := s.Client.Send(ctx, message)
+	_, _, err = s.Client.Send(ctx, message)
 	if err != nil {
 		return err
 
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+)
+
+type SMTPMailer struct {
+	Host      string
+	Port      int
+	Username  string
+	Password  string
+	FromEmail string
+}
+
+func NewSMTP(host string, port int, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		Host:      host,
+		Port:      port,
+		Username:  username,
+		Password:  password,
+		FromEmail: from,
+	}
+}
+
+// Send always delivers to the configured server. isSandbox is for providers
+// with a sandbox mode, in development the server is a local one like MailHog.
+func (s *SMTPMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+	subject, body, err := renderTemplate(templateFile, data)
+	if err != nil {
+		return err
+	}
+	// names and subjects are encoded, so they cannot break out of their header
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", (&mail.Address{Name: FromName, Address: s.FromEmail}).String())
+	fmt.Fprintf(&msg, "To: %s\r\n", (&mail.Address{Name: username, Address: email}).String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n\r\n")
+	msg.WriteString(body)
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, fmt.Sprint(s.Port))
+	return smtp.SendMail(addr, auth, s.FromEmail, []string{email}, []byte(msg.String()))
+}
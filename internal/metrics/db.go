@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// RegisterDBStats exposes the connection pool statistics of db, read at every
+// scrape.
+func (reg *Registry) RegisterDBStats(db *sql.DB) {
+	reg.register(collectorFunc(func(b *strings.Builder) {
+		stats := db.Stats()
+		for _, m := range []struct {
+			name, help, typ string
+			value           float64
+		}{
+			{"db_max_open_connections", "Maximum number of open connections to the database.", "gauge", float64(stats.MaxOpenConnections)},
+			{"db_open_connections", "Number of established connections, in use and idle.", "gauge", float64(stats.OpenConnections)},
+			{"db_in_use_connections", "Number of connections currently in use.", "gauge", float64(stats.InUse)},
+			{"db_idle_connections", "Number of idle connections.", "gauge", float64(stats.Idle)},
+			{"db_wait_count_total", "Total number of connections waited for.", "counter", float64(stats.WaitCount)},
+			{"db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", "counter", stats.WaitDuration.Seconds()},
+			{"db_max_idle_closed_total", "Total number of connections closed due to the idle connection limit.", "counter", float64(stats.MaxIdleClosed)},
+			{"db_max_idle_time_closed_total", "Total number of connections closed due to the idle time limit.", "counter", float64(stats.MaxIdleTimeClosed)},
+			{"db_max_lifetime_closed_total", "Total number of connections closed due to the connection lifetime limit.", "counter", float64(stats.MaxLifetimeClosed)},
+		} {
+			writeHeader(b, m.name, m.help, m.typ)
+			writeSample(b, m.name, nil, nil, m.value)
+		}
+	}))
+}
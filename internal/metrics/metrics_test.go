@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/likhon22/social/internal/store"
+)
+
+func scrape(t *testing.T, reg *Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestExposition(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("posts_created_total", "Number of posts created.")
+	follows := reg.NewCounter("follows_total", "Number of follows\nand requests.", "kind")
+	follows.Inc("request")
+	follows.Inc("follow")
+	follows.Add(2, "follow")
+	durations := reg.NewHistogram("request_seconds", "Duration.", []float64{.1, 1}, "route")
+	durations.Observe(.05, `/users/{id}"`)
+	durations.Observe(.5, `/users/{id}"`)
+	durations.Observe(5, `/users/{id}"`)
+
+	want := `# HELP posts_created_total Number of posts created.
+# TYPE posts_created_total counter
+posts_created_total 0
+# HELP follows_total Number of follows\nand requests.
+# TYPE follows_total counter
+follows_total{kind="follow"} 3
+follows_total{kind="request"} 1
+# HELP request_seconds Duration.
+# TYPE request_seconds histogram
+request_seconds_bucket{route="/users/{id}\"",le="0.1"} 1
+request_seconds_bucket{route="/users/{id}\"",le="1"} 2
+request_seconds_bucket{route="/users/{id}\"",le="+Inf"} 3
+request_seconds_sum{route="/users/{id}\""} 5.55
+request_seconds_count{route="/users/{id}\""} 3
+`
+	if got := scrape(t, reg); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLabelValuesMustMatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("a missing label value did not panic")
+		}
+	}()
+	NewRegistry().NewCounter("follows_total", "", "kind").Inc()
+}
+
+func TestDBStats(t *testing.T) {
+	// the stats of a pool are read without connecting
+	db, err := sql.Open("postgres", "postgres://localhost/none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(25)
+	reg := NewRegistry()
+	reg.RegisterDBStats(db)
+	got := scrape(t, reg)
+	for _, line := range []string{"db_max_open_connections 25\n", "# TYPE db_wait_count_total counter\n", "db_in_use_connections 0\n"} {
+		if !strings.Contains(got, line) {
+			t.Errorf("missing %q in\n%s", line, got)
+		}
+	}
+}
+
+// nopPosts answers every post lookup with no post.
+type nopPosts struct {
+	store.Posts
+}
+
+func (nopPosts) GetByID(ctx context.Context, id int64, viewerId int64) (*store.Post, error) {
+	return nil, nil
+}
+
+func TestInstrumentStorage(t *testing.T) {
+	reg := NewRegistry()
+	duration := reg.NewHistogram("store_query_duration_seconds", "", DefaultBuckets, "store", "method")
+	s := &store.Storage{Posts: nopPosts{}}
+	InstrumentStorage(s, duration)
+
+	for range 2 {
+		if _, err := s.Posts.GetByID(context.Background(), 1, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := scrape(t, reg); !strings.Contains(got, `store_query_duration_seconds_count{store="posts",method="GetByID"} 2`) {
+		t.Errorf("the lookups were not timed:\n%s", got)
+	}
+}
@@ -0,0 +1,428 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/likhon22/social/internal/store"
+)
+
+// InstrumentStorage records in duration how long every method of the stores
+// of s takes, labelled by store and method. It wraps the stores in place, so
+// decorators added afterwards, like caches, are left out of the measure.
+func InstrumentStorage(s *store.Storage, duration *Histogram) {
+	s.Posts = posts{Posts: s.Posts, timer: timer{duration, "posts"}}
+	s.Users = users{Users: s.Users, timer: timer{duration, "users"}}
+	s.Comments = comments{Comments: s.Comments, timer: timer{duration, "comments"}}
+	s.Followers = followers{Followers: s.Followers, timer: timer{duration, "followers"}}
+	s.Sessions = sessions{Sessions: s.Sessions, timer: timer{duration, "sessions"}}
+	s.Roles = roles{Roles: s.Roles, timer: timer{duration, "roles"}}
+	s.Outbox = outbox{Outbox: s.Outbox, timer: timer{duration, "outbox"}}
+	s.Search = search{Search: s.Search, timer: timer{duration, "search"}}
+	s.Reactions = reactions{Reactions: s.Reactions, timer: timer{duration, "reactions"}}
+	s.Blocks = blocks{Blocks: s.Blocks, timer: timer{duration, "blocks"}}
+	s.Uploads = uploads{Uploads: s.Uploads, timer: timer{duration, "uploads"}}
+	s.Hashtags = hashtags{Hashtags: s.Hashtags, timer: timer{duration, "hashtags"}}
+	s.Notifications = notifications{Notifications: s.Notifications, timer: timer{duration, "notifications"}}
+}
+
+// timer observes the duration of the methods of one store.
+type timer struct {
+	duration *Histogram
+	store    string
+}
+
+func (t timer) since(method string, start time.Time) {
+	t.duration.Observe(time.Since(start).Seconds(), t.store, method)
+}
+
+type posts struct {
+	store.Posts
+	timer
+}
+
+func (s posts) Create(ctx context.Context, post *store.Post) error {
+	defer s.since("Create", time.Now())
+	return s.Posts.Create(ctx, post)
+}
+
+func (s posts) GetAll(ctx context.Context, viewerId int64, fq store.PaginatedFeedQuery) ([]*store.Post, error) {
+	defer s.since("GetAll", time.Now())
+	return s.Posts.GetAll(ctx, viewerId, fq)
+}
+
+func (s posts) GetByID(ctx context.Context, id int64, viewerId int64) (*store.Post, error) {
+	defer s.since("GetByID", time.Now())
+	return s.Posts.GetByID(ctx, id, viewerId)
+}
+
+func (s posts) FilterViewers(ctx context.Context, postID int64, viewerIds []int64) ([]int64, error) {
+	defer s.since("FilterViewers", time.Now())
+	return s.Posts.FilterViewers(ctx, postID, viewerIds)
+}
+
+func (s posts) CanView(ctx context.Context, postID int64, viewerId int64) (bool, error) {
+	defer s.since("CanView", time.Now())
+	return s.Posts.CanView(ctx, postID, viewerId)
+}
+
+func (s posts) GetByTag(ctx context.Context, tag string, viewerId int64, fq store.PaginatedFeedQuery) ([]*store.Post, error) {
+	defer s.since("GetByTag", time.Now())
+	return s.Posts.GetByTag(ctx, tag, viewerId, fq)
+}
+
+func (s posts) Delete(ctx context.Context, postID int64) error {
+	defer s.since("Delete", time.Now())
+	return s.Posts.Delete(ctx, postID)
+}
+
+func (s posts) Update(ctx context.Context, postID int64, post *store.Post) error {
+	defer s.since("Update", time.Now())
+	return s.Posts.Update(ctx, postID, post)
+}
+
+func (s posts) GetUserFeed(ctx context.Context, userId int64, fq store.PaginatedFeedQuery) (*[]store.PostWithMetaData, error) {
+	defer s.since("GetUserFeed", time.Now())
+	return s.Posts.GetUserFeed(ctx, userId, fq)
+}
+
+type users struct {
+	store.Users
+	timer
+}
+
+func (s users) Create(ctx context.Context, tx *sql.Tx, user *store.User) error {
+	defer s.since("Create", time.Now())
+	return s.Users.Create(ctx, tx, user)
+}
+
+func (s users) GetUsers(ctx context.Context) (*[]store.User, error) {
+	defer s.since("GetUsers", time.Now())
+	return s.Users.GetUsers(ctx)
+}
+
+func (s users) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	defer s.since("GetUserByEmail", time.Now())
+	return s.Users.GetUserByEmail(ctx, email)
+}
+
+func (s users) GetUserById(ctx context.Context, id int64) (*store.User, error) {
+	defer s.since("GetUserById", time.Now())
+	return s.Users.GetUserById(ctx, id)
+}
+
+func (s users) CreateAndInvite(ctx context.Context, user *store.User, token string, invitationExp time.Duration, invitation *store.OutboxMessage) error {
+	defer s.since("CreateAndInvite", time.Now())
+	return s.Users.CreateAndInvite(ctx, user, token, invitationExp, invitation)
+}
+
+func (s users) Activate(ctx context.Context, token string, exp time.Duration) error {
+	defer s.since("Activate", time.Now())
+	return s.Users.Activate(ctx, token, exp)
+}
+
+func (s users) CreatePasswordReset(ctx context.Context, userId int64, token string, exp time.Duration, email *store.OutboxMessage) error {
+	defer s.since("CreatePasswordReset", time.Now())
+	return s.Users.CreatePasswordReset(ctx, userId, token, exp, email)
+}
+
+func (s users) ResetPassword(ctx context.Context, token string, password *store.Password) error {
+	defer s.since("ResetPassword", time.Now())
+	return s.Users.ResetPassword(ctx, token, password)
+}
+
+func (s users) SetPrivate(ctx context.Context, userId int64, private bool) ([]int64, error) {
+	defer s.since("SetPrivate", time.Now())
+	return s.Users.SetPrivate(ctx, userId, private)
+}
+
+type comments struct {
+	store.Comments
+	timer
+}
+
+func (s comments) GetCommentsWithPost(ctx context.Context, postID int64, fq store.PaginatedFeedQuery, opts store.ThreadOptions) (*[]store.Comment, error) {
+	defer s.since("GetCommentsWithPost", time.Now())
+	return s.Comments.GetCommentsWithPost(ctx, postID, fq, opts)
+}
+
+func (s comments) GetReplies(ctx context.Context, commentID int64, fq store.PaginatedFeedQuery, opts store.ThreadOptions) (*[]store.Comment, error) {
+	defer s.since("GetReplies", time.Now())
+	return s.Comments.GetReplies(ctx, commentID, fq, opts)
+}
+
+func (s comments) CreateComment(ctx context.Context, comments *store.Comment) error {
+	defer s.since("CreateComment", time.Now())
+	return s.Comments.CreateComment(ctx, comments)
+}
+
+func (s comments) GetByID(ctx context.Context, id int64, viewerId int64) (*store.Comment, error) {
+	defer s.since("GetByID", time.Now())
+	return s.Comments.GetByID(ctx, id, viewerId)
+}
+
+func (s comments) GetByIDIncludingDeleted(ctx context.Context, id int64, viewerId int64) (*store.Comment, error) {
+	defer s.since("GetByIDIncludingDeleted", time.Now())
+	return s.Comments.GetByIDIncludingDeleted(ctx, id, viewerId)
+}
+
+func (s comments) Update(ctx context.Context, commentID int64, content string, editorID int64) (*store.Comment, error) {
+	defer s.since("Update", time.Now())
+	return s.Comments.Update(ctx, commentID, content, editorID)
+}
+
+func (s comments) Delete(ctx context.Context, commentID int64) error {
+	defer s.since("Delete", time.Now())
+	return s.Comments.Delete(ctx, commentID)
+}
+
+func (s comments) GetEdits(ctx context.Context, commentID int64) ([]store.CommentEdit, error) {
+	defer s.since("GetEdits", time.Now())
+	return s.Comments.GetEdits(ctx, commentID)
+}
+
+func (s comments) GetByUser(ctx context.Context, userID int64, viewerId int64, fq store.PaginatedFeedQuery) (*[]store.Comment, error) {
+	defer s.since("GetByUser", time.Now())
+	return s.Comments.GetByUser(ctx, userID, viewerId, fq)
+}
+
+type followers struct {
+	store.Followers
+	timer
+}
+
+func (s followers) Follow(ctx context.Context, userId int64, followerId int64) (bool, error) {
+	defer s.since("Follow", time.Now())
+	return s.Followers.Follow(ctx, userId, followerId)
+}
+
+func (s followers) UnFOllow(ctx context.Context, userId int64, unFOllowerId int64) error {
+	defer s.since("UnFOllow", time.Now())
+	return s.Followers.UnFOllow(ctx, userId, unFOllowerId)
+}
+
+func (s followers) GetRequests(ctx context.Context, userId int64, fq store.PaginatedFeedQuery) ([]store.FollowUser, error) {
+	defer s.since("GetRequests", time.Now())
+	return s.Followers.GetRequests(ctx, userId, fq)
+}
+
+func (s followers) ApproveRequest(ctx context.Context, userId int64, requesterId int64) error {
+	defer s.since("ApproveRequest", time.Now())
+	return s.Followers.ApproveRequest(ctx, userId, requesterId)
+}
+
+func (s followers) RejectRequest(ctx context.Context, userId int64, requesterId int64) error {
+	defer s.since("RejectRequest", time.Now())
+	return s.Followers.RejectRequest(ctx, userId, requesterId)
+}
+
+func (s followers) GetFollowers(ctx context.Context, userId int64, viewerId int64, fq store.PaginatedFeedQuery) ([]store.FollowUser, error) {
+	defer s.since("GetFollowers", time.Now())
+	return s.Followers.GetFollowers(ctx, userId, viewerId, fq)
+}
+
+func (s followers) GetFollowing(ctx context.Context, userId int64, viewerId int64, fq store.PaginatedFeedQuery) ([]store.FollowUser, error) {
+	defer s.since("GetFollowing", time.Now())
+	return s.Followers.GetFollowing(ctx, userId, viewerId, fq)
+}
+
+func (s followers) GetCounts(ctx context.Context, userId int64) (*store.FollowCounts, error) {
+	defer s.since("GetCounts", time.Now())
+	return s.Followers.GetCounts(ctx, userId)
+}
+
+func (s followers) GetFollowedIDs(ctx context.Context, userId int64) ([]int64, error) {
+	defer s.since("GetFollowedIDs", time.Now())
+	return s.Followers.GetFollowedIDs(ctx, userId)
+}
+
+func (s followers) GetRelation(ctx context.Context, userId int64, viewerId int64) (store.Relation, error) {
+	defer s.since("GetRelation", time.Now())
+	return s.Followers.GetRelation(ctx, userId, viewerId)
+}
+
+func (s followers) FilterFollowers(ctx context.Context, userId int64, ids []int64) ([]int64, error) {
+	defer s.since("FilterFollowers", time.Now())
+	return s.Followers.FilterFollowers(ctx, userId, ids)
+}
+
+type sessions struct {
+	store.Sessions
+	timer
+}
+
+func (s sessions) Create(ctx context.Context, session *store.Session) error {
+	defer s.since("Create", time.Now())
+	return s.Sessions.Create(ctx, session)
+}
+
+func (s sessions) Rotate(ctx context.Context, oldToken string, session *store.Session) error {
+	defer s.since("Rotate", time.Now())
+	return s.Sessions.Rotate(ctx, oldToken, session)
+}
+
+type roles struct {
+	store.Roles
+	timer
+}
+
+func (s roles) GetByName(ctx context.Context, name string) (*store.Role, error) {
+	defer s.since("GetByName", time.Now())
+	return s.Roles.GetByName(ctx, name)
+}
+
+type outbox struct {
+	store.Outbox
+	timer
+}
+
+func (s outbox) Enqueue(ctx context.Context, msg *store.OutboxMessage) error {
+	defer s.since("Enqueue", time.Now())
+	return s.Outbox.Enqueue(ctx, msg)
+}
+
+func (s outbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]store.OutboxMessage, error) {
+	defer s.since("Claim", time.Now())
+	return s.Outbox.Claim(ctx, limit, lease)
+}
+
+func (s outbox) Complete(ctx context.Context, id int64) error {
+	defer s.since("Complete", time.Now())
+	return s.Outbox.Complete(ctx, id)
+}
+
+func (s outbox) Retry(ctx context.Context, id int64, lastErr string, runAt time.Time) error {
+	defer s.since("Retry", time.Now())
+	return s.Outbox.Retry(ctx, id, lastErr, runAt)
+}
+
+func (s outbox) DeadLetter(ctx context.Context, id int64, lastErr string) error {
+	defer s.since("DeadLetter", time.Now())
+	return s.Outbox.DeadLetter(ctx, id, lastErr)
+}
+
+type search struct {
+	store.Search
+	timer
+}
+
+func (s search) SearchPosts(ctx context.Context, viewerId int64, fq store.PaginatedFeedQuery) ([]store.SearchResult, error) {
+	defer s.since("SearchPosts", time.Now())
+	return s.Search.SearchPosts(ctx, viewerId, fq)
+}
+
+func (s search) SearchComments(ctx context.Context, viewerId int64, fq store.PaginatedFeedQuery) ([]store.SearchResult, error) {
+	defer s.since("SearchComments", time.Now())
+	return s.Search.SearchComments(ctx, viewerId, fq)
+}
+
+func (s search) SearchUsers(ctx context.Context, fq store.PaginatedFeedQuery) ([]store.SearchResult, error) {
+	defer s.since("SearchUsers", time.Now())
+	return s.Search.SearchUsers(ctx, fq)
+}
+
+type reactions struct {
+	store.Reactions
+	timer
+}
+
+func (s reactions) Set(ctx context.Context, reaction *store.Reaction) error {
+	defer s.since("Set", time.Now())
+	return s.Reactions.Set(ctx, reaction)
+}
+
+func (s reactions) DeletePostReaction(ctx context.Context, postID, userID int64) error {
+	defer s.since("DeletePostReaction", time.Now())
+	return s.Reactions.DeletePostReaction(ctx, postID, userID)
+}
+
+func (s reactions) DeleteCommentReaction(ctx context.Context, commentID, userID int64) error {
+	defer s.since("DeleteCommentReaction", time.Now())
+	return s.Reactions.DeleteCommentReaction(ctx, commentID, userID)
+}
+
+type blocks struct {
+	store.Blocks
+	timer
+}
+
+func (s blocks) Block(ctx context.Context, blockerId, blockedId int64) error {
+	defer s.since("Block", time.Now())
+	return s.Blocks.Block(ctx, blockerId, blockedId)
+}
+
+func (s blocks) Unblock(ctx context.Context, blockerId, blockedId int64) error {
+	defer s.since("Unblock", time.Now())
+	return s.Blocks.Unblock(ctx, blockerId, blockedId)
+}
+
+func (s blocks) Mute(ctx context.Context, muterId, mutedId int64) error {
+	defer s.since("Mute", time.Now())
+	return s.Blocks.Mute(ctx, muterId, mutedId)
+}
+
+func (s blocks) Unmute(ctx context.Context, muterId, mutedId int64) error {
+	defer s.since("Unmute", time.Now())
+	return s.Blocks.Unmute(ctx, muterId, mutedId)
+}
+
+func (s blocks) IsBlocked(ctx context.Context, userId, otherId int64) (bool, error) {
+	defer s.since("IsBlocked", time.Now())
+	return s.Blocks.IsBlocked(ctx, userId, otherId)
+}
+
+type uploads struct {
+	store.Uploads
+	timer
+}
+
+func (s uploads) Create(ctx context.Context, media *store.Media, process *store.OutboxMessage) error {
+	defer s.since("Create", time.Now())
+	return s.Uploads.Create(ctx, media, process)
+}
+
+func (s uploads) GetByKey(ctx context.Context, key string) (*store.Media, error) {
+	defer s.since("GetByKey", time.Now())
+	return s.Uploads.GetByKey(ctx, key)
+}
+
+func (s uploads) SetProcessed(ctx context.Context, media *store.Media) error {
+	defer s.since("SetProcessed", time.Now())
+	return s.Uploads.SetProcessed(ctx, media)
+}
+
+func (s uploads) SetFailed(ctx context.Context, mediaID int64) error {
+	defer s.since("SetFailed", time.Now())
+	return s.Uploads.SetFailed(ctx, mediaID)
+}
+
+type hashtags struct {
+	store.Hashtags
+	timer
+}
+
+func (s hashtags) GetTrending(ctx context.Context, window time.Duration, limit int) ([]store.TrendingTag, error) {
+	defer s.since("GetTrending", time.Now())
+	return s.Hashtags.GetTrending(ctx, window, limit)
+}
+
+type notifications struct {
+	store.Notifications
+	timer
+}
+
+func (s notifications) GetByUser(ctx context.Context, userId int64, unreadOnly bool, fq store.PaginatedFeedQuery) ([]store.Notification, time.Time, error) {
+	defer s.since("GetByUser", time.Now())
+	return s.Notifications.GetByUser(ctx, userId, unreadOnly, fq)
+}
+
+func (s notifications) MarkRead(ctx context.Context, userId int64, ids []int64) (int64, error) {
+	defer s.since("MarkRead", time.Now())
+	return s.Notifications.MarkRead(ctx, userId, ids)
+}
+
+func (s notifications) CountUnread(ctx context.Context, userId int64) (int, error) {
+	defer s.since("CountUnread", time.Now())
+	return s.Notifications.CountUnread(ctx, userId)
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Memory keeps the limits in this process. Every API instance counts on its
+// own, so clients get the budget once per instance.
+type Memory struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+	// sliding window
+	start    time.Time
+	current  int
+	previous int
+
+	expires time.Time
+}
+
+// sweepInterval is how often entries of idle clients are dropped.
+const sweepInterval = time.Minute
+
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]*memoryEntry{}}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	entry, ok := m.entries[key]
+	switch policy.Algorithm {
+	case TokenBucket:
+		tokens := float64(policy.burst())
+		if ok {
+			tokens = refill(policy, entry.tokens, entry.last, now)
+		} else {
+			entry = &memoryEntry{}
+			m.entries[key] = entry
+		}
+		allowed := tokens >= 1
+		if allowed {
+			tokens--
+		}
+		res := bucketResult(policy, tokens, allowed)
+		entry.tokens, entry.last, entry.expires = tokens, now, now.Add(res.Reset)
+		return res, nil
+	case SlidingWindow:
+		start := windowStart(policy, now)
+		if !ok {
+			entry = &memoryEntry{start: start}
+			m.entries[key] = entry
+		}
+		if !entry.start.Equal(start) {
+			entry.previous = 0
+			if entry.start.Equal(start.Add(-policy.Window)) {
+				entry.previous = entry.current
+			}
+			entry.start, entry.current = start, 0
+		}
+		weight := 1 - float64(now.Sub(start))/float64(policy.Window)
+		allowed := float64(entry.previous)*weight+float64(entry.current)+1 <= float64(policy.Requests)
+		if allowed {
+			entry.current++
+		}
+		entry.expires = start.Add(2 * policy.Window)
+		return windowResult(policy, now, start, entry.current, entry.previous, allowed), nil
+	}
+	return Result{}, fmt.Errorf("unknown rate limit algorithm %q", policy.Algorithm)
+}
+
+func (m *Memory) sweep(now time.Time) {
+	for key, entry := range m.entries {
+		if now.After(entry.expires) {
+			delete(m.entries, key)
+		}
+	}
+	m.lastSweep = now
+}
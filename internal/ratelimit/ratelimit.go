@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Algorithms a Policy can use.
+const (
+	// TokenBucket refills Requests tokens per Window into a bucket holding up
+	// to Burst, every request takes one. It allows short bursts.
+	TokenBucket = "token_bucket"
+	// SlidingWindow allows Requests per Window, weighing the count of the
+	// previous fixed window by how much of it still overlaps the sliding one.
+	SlidingWindow = "sliding_window"
+)
+
+// Policy limits the requests of each client on a group of routes.
+type Policy struct {
+	Algorithm string
+	Requests  int
+	Window    time.Duration
+	// Burst is the size of the bucket of TokenBucket, Requests when unset.
+	Burst int
+	// PerUser counts the requests of authenticated users by user instead of
+	// by IP address. Anonymous requests are still counted by IP.
+	PerUser bool
+}
+
+func (p Policy) burst() int {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Requests
+}
+
+// String describes the policy for the RateLimit-Policy header.
+func (p Policy) String() string {
+	s := fmt.Sprintf("%d;w=%d", p.Requests, int(p.Window.Seconds()))
+	if p.Algorithm == TokenBucket {
+		s += fmt.Sprintf(";burst=%d", p.burst())
+	}
+	return s
+}
+
+// Result is the outcome of a request under a policy.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the client has its full budget again.
+	Reset time.Duration
+	// RetryAfter is how long a refused client has to wait.
+	RetryAfter time.Duration
+}
+
+// Store keeps the state of the limits, in this process or shared by all API
+// instances.
+type Store interface {
+	// Allow counts a request of key under the policy.
+	Allow(ctx context.Context, key string, policy Policy, now time.Time) (Result, error)
+}
+
+// bucketResult describes a token bucket left with tokens after a request.
+func bucketResult(policy Policy, tokens float64, allowed bool) Result {
+	perToken := float64(policy.Window) / float64(policy.Requests)
+	burst := float64(policy.burst())
+	res := Result{
+		Allowed:   allowed,
+		Limit:     policy.burst(),
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((burst - tokens) * perToken),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) * perToken)
+	}
+	return res
+}
+
+// refill returns the tokens of a bucket that had tokens at last.
+func refill(policy Policy, tokens float64, last, now time.Time) float64 {
+	elapsed := now.Sub(last)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	tokens += float64(elapsed) * float64(policy.Requests) / float64(policy.Window)
+	return math.Min(tokens, float64(policy.burst()))
+}
+
+// windowStart returns the start of the fixed window now is in. Windows are
+// counted in milliseconds from the Unix epoch, like in the Redis script.
+func windowStart(policy Policy, now time.Time) time.Time {
+	ms, window := now.UnixMilli(), policy.Window.Milliseconds()
+	return time.UnixMilli(ms - ms%window)
+}
+
+// windowResult describes a sliding window after a request, when the fixed
+// window starting at start has counted current requests and the one before
+// it previous.
+func windowResult(policy Policy, now, start time.Time, current, previous int, allowed bool) Result {
+	limit := float64(policy.Requests)
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(policy.Window)
+	used := float64(previous)*weight + float64(current)
+	res := Result{
+		Allowed:   allowed,
+		Limit:     policy.Requests,
+		Remaining: int(math.Max(0, math.Floor(limit-used))),
+		// the previous window no longer counts at the end of this one
+		Reset: policy.Window - elapsed,
+	}
+	if allowed {
+		return res
+	}
+	if float64(current)+1 <= limit {
+		// wait until enough of the previous window slid out
+		wait := float64(policy.Window) * (1 - (limit-1-float64(current))/float64(previous))
+		res.RetryAfter = time.Duration(wait) - elapsed
+	} else {
+		// wait for the next window, and for enough of this one to slide out
+		wait := float64(policy.Window) * (1 - (limit-1)/float64(current))
+		res.RetryAfter = policy.Window - elapsed + time.Duration(wait)
+	}
+	if res.RetryAfter < 0 {
+		res.RetryAfter = 0
+	}
+	return res
+}
@@ -0,0 +1,198 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/likhon22/social/internal/cache"
+)
+
+// epoch starts a fixed window of every policy in the tests.
+var epoch = time.UnixMilli(1_700_000_000_000)
+
+func TestRefill(t *testing.T) {
+	policy := Policy{Algorithm: TokenBucket, Requests: 10, Window: 10 * time.Second, Burst: 5}
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"nothing elapsed", 2, 0, 2},
+		{"one token", 0, time.Second, 1},
+		{"part of a token", 0, 2500 * time.Millisecond, 2.5},
+		{"capped at the burst", 1, time.Hour, 5},
+		{"clock going back", 3, -time.Second, 3},
+	}
+	for _, tt := range tests {
+		if got := refill(policy, tt.tokens, epoch, epoch.Add(tt.elapsed)); got != tt.want {
+			t.Errorf("%s: got %v tokens, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBucketResult(t *testing.T) {
+	policy := Policy{Algorithm: TokenBucket, Requests: 10, Window: 10 * time.Second, Burst: 5}
+	tests := []struct {
+		name    string
+		tokens  float64
+		allowed bool
+		want    Result
+	}{
+		{"full", 5, true, Result{Allowed: true, Limit: 5, Remaining: 5}},
+		{"partly used", 3.5, true, Result{Allowed: true, Limit: 5, Remaining: 3, Reset: 1500 * time.Millisecond}},
+		{"empty", 0, true, Result{Allowed: true, Limit: 5, Remaining: 0, Reset: 5 * time.Second}},
+		{"refused", 0.25, false, Result{Limit: 5, Reset: 4750 * time.Millisecond, RetryAfter: 750 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		if got := bucketResult(policy, tt.tokens, tt.allowed); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWindowResult(t *testing.T) {
+	policy := Policy{Algorithm: SlidingWindow, Requests: 10, Window: 10 * time.Second}
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		current  int
+		previous int
+		allowed  bool
+		want     Result
+	}{
+		{"first request", 0, 1, 0, true, Result{Allowed: true, Limit: 10, Remaining: 9, Reset: 10 * time.Second}},
+		// 10 * 0.75 of the previous window still counts
+		{"weighted previous", 2500 * time.Millisecond, 1, 10, true, Result{Allowed: true, Limit: 10, Remaining: 1, Reset: 7500 * time.Millisecond}},
+		{"over the limit", 5 * time.Second, 4, 10, false, Result{Limit: 10, Remaining: 1, Reset: 5 * time.Second}},
+		// 2 + 10 * w + 1 <= 10 once w <= 0.7, at 3s
+		{"wait for the previous window", time.Second, 2, 10, false, Result{Limit: 10, Reset: 9 * time.Second, RetryAfter: 2 * time.Second}},
+		// the next window, and 10 * w + 1 <= 10 there, at 1s into it
+		{"wait for the next window", 4 * time.Second, 10, 0, false, Result{Limit: 10, Reset: 6 * time.Second, RetryAfter: 7 * time.Second}},
+	}
+	for _, tt := range tests {
+		got := windowResult(policy, epoch.Add(tt.elapsed), epoch, tt.current, tt.previous, tt.allowed)
+		got.RetryAfter = got.RetryAfter.Round(time.Millisecond)
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+type step struct {
+	at         time.Duration
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+var storeTests = []struct {
+	name   string
+	policy Policy
+	steps  []step
+}{
+	{
+		name:   "token bucket",
+		policy: Policy{Algorithm: TokenBucket, Requests: 10, Window: 10 * time.Second, Burst: 3},
+		steps: []step{
+			// the burst
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, time.Second},
+			{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+			// a token a second
+			{time.Second, true, 0, 0},
+			{2500 * time.Millisecond, true, 0, 0},
+			// refilled up to the burst only
+			{time.Minute, true, 2, 0},
+		},
+	},
+	{
+		name:   "sliding window",
+		policy: Policy{Algorithm: SlidingWindow, Requests: 3, Window: 10 * time.Second},
+		steps: []step{
+			{time.Second, true, 2, 0},
+			{time.Second, true, 1, 0},
+			{2 * time.Second, true, 0, 0},
+			// 3 + 1 > 3 until the next window, where 3 * w + 1 <= 3 from w = 2/3
+			{5 * time.Second, false, 0, 5*time.Second + 3333333333},
+			{11 * time.Second, false, 0, 2333333334},
+			{13500 * time.Millisecond, true, 0, 0},
+			// 3 * 0.3 + 2 used, less than one request left
+			{17 * time.Second, true, 0, 0},
+			// two windows on, nothing counts
+			{40 * time.Second, true, 2, 0},
+		},
+	},
+}
+
+func runStoreTests(t *testing.T, s Store, prefix string) {
+	ctx := context.Background()
+	for _, tt := range storeTests {
+		key := fmt.Sprintf("%s%s:%d", prefix, tt.name, time.Now().UnixNano())
+		for i, st := range tt.steps {
+			res, err := s.Allow(ctx, key, tt.policy, epoch.Add(st.at))
+			if err != nil {
+				t.Fatalf("%s step %d: %v", tt.name, i, err)
+			}
+			// the Redis store counts in milliseconds
+			retryAfter := res.RetryAfter.Round(time.Millisecond)
+			if res.Allowed != st.allowed || res.Remaining != st.remaining || retryAfter != st.retryAfter.Round(time.Millisecond) {
+				t.Errorf("%s step %d at %v: got allowed %v, remaining %d, retry after %v, want %v, %d, %v",
+					tt.name, i, st.at, res.Allowed, res.Remaining, res.RetryAfter, st.allowed, st.remaining, st.retryAfter)
+			}
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	runStoreTests(t, NewMemory(), "")
+}
+
+func TestMemoryKeysAreSeparate(t *testing.T) {
+	m := NewMemory()
+	policy := Policy{Algorithm: SlidingWindow, Requests: 1, Window: time.Minute}
+	for _, key := range []string{"auth:ip:1", "auth:ip:2"} {
+		if res, _ := m.Allow(context.Background(), key, policy, epoch); !res.Allowed {
+			t.Errorf("%s: refused its first request", key)
+		}
+	}
+	if res, _ := m.Allow(context.Background(), "auth:ip:1", policy, epoch); res.Allowed {
+		t.Error("auth:ip:1: allowed over the limit")
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	m := NewMemory()
+	policy := Policy{Algorithm: TokenBucket, Requests: 1, Window: time.Second}
+	m.Allow(context.Background(), "idle", policy, epoch)
+	m.Allow(context.Background(), "active", policy, epoch.Add(2*sweepInterval))
+	if _, ok := m.entries["idle"]; ok {
+		t.Error("the entry of an idle client was kept")
+	}
+	if _, ok := m.entries["active"]; !ok {
+		t.Error("the entry of an active client was dropped")
+	}
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	if _, err := NewMemory().Allow(context.Background(), "k", Policy{Algorithm: "leaky"}, epoch); err == nil {
+		t.Error("got no error")
+	}
+}
+
+// TestRedis runs the Lua scripts through the same steps as the memory store.
+// It is skipped unless TEST_REDIS_ADDR points at a Redis server.
+func TestRedis(t *testing.T) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR is not set")
+	}
+	client := cache.NewRedis(cache.RedisConfig{Addr: addr})
+	defer client.Close()
+	runStoreTests(t, NewRedis(client), "test:")
+}
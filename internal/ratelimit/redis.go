@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/likhon22/social/internal/cache"
+)
+
+// Redis keeps the limits in a Redis server, shared by all API instances. Each
+// request is counted by a Lua script, which Redis runs atomically.
+type Redis struct {
+	client *cache.Redis
+}
+
+func NewRedis(client *cache.Redis) *Redis {
+	return &Redis{client: client}
+}
+
+const redisPrefix = "ratelimit:"
+
+// tokenBucketScript takes a token from the bucket in KEYS[1]. ARGV holds the
+// time in milliseconds, the tokens added per millisecond and the size of the
+// bucket. It returns whether a token was taken and the tokens left.
+const tokenBucketScript = `
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+// slidingWindowScript counts a request in the window in KEYS[1]. ARGV holds
+// the time in milliseconds, the window in milliseconds and the limit. It
+// returns whether the request was counted, and the counts of the current and
+// previous fixed windows.
+const slidingWindowScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local start = now - (now % window)
+local state = redis.call('HMGET', KEYS[1], 'start', 'current', 'previous')
+local current = tonumber(state[2]) or 0
+local previous = tonumber(state[3]) or 0
+local last = tonumber(state[1]) or start
+if last ~= start then
+	if last == start - window then
+		previous = current
+	else
+		previous = 0
+	end
+	current = 0
+end
+local weight = 1 - (now - start) / window
+local allowed = 0
+if previous * weight + current + 1 <= limit then
+	current = current + 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'start', start, 'current', current, 'previous', previous)
+redis.call('PEXPIRE', KEYS[1], 2 * window)
+return {allowed, current, previous}
+`
+
+func (s *Redis) Allow(ctx context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	ms := strconv.FormatInt(now.UnixMilli(), 10)
+	switch policy.Algorithm {
+	case TokenBucket:
+		rate := float64(policy.Requests) / float64(policy.Window.Milliseconds())
+		reply, err := s.client.Eval(ctx, tokenBucketScript, []string{redisPrefix + key},
+			ms, strconv.FormatFloat(rate, 'g', -1, 64), strconv.Itoa(policy.burst()))
+		if err != nil {
+			return Result{}, err
+		}
+		values, ok := reply.([]any)
+		if !ok || len(values) != 2 {
+			return Result{}, fmt.Errorf("unexpected token bucket reply %v", reply)
+		}
+		raw, ok := values[1].([]byte)
+		if !ok {
+			return Result{}, fmt.Errorf("unexpected token bucket reply %v", reply)
+		}
+		tokens, err := strconv.ParseFloat(string(raw), 64)
+		if err != nil {
+			return Result{}, err
+		}
+		return bucketResult(policy, tokens, values[0] == int64(1)), nil
+	case SlidingWindow:
+		reply, err := s.client.Eval(ctx, slidingWindowScript, []string{redisPrefix + key},
+			ms, strconv.FormatInt(policy.Window.Milliseconds(), 10), strconv.Itoa(policy.Requests))
+		if err != nil {
+			return Result{}, err
+		}
+		values, ok := reply.([]any)
+		if !ok || len(values) != 3 {
+			return Result{}, fmt.Errorf("unexpected sliding window reply %v", reply)
+		}
+		current, ok1 := values[1].(int64)
+		previous, ok2 := values[2].(int64)
+		if !ok1 || !ok2 {
+			return Result{}, fmt.Errorf("unexpected sliding window reply %v", reply)
+		}
+		start := windowStart(policy, now)
+		return windowResult(policy, now, start, int(current), int(previous), values[0] == int64(1)), nil
+	}
+	return Result{}, fmt.Errorf("unknown rate limit algorithm %q", policy.Algorithm)
+}
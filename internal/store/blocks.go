@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrBlocked is returned when one of the two users blocks the other.
+var ErrBlocked = errors.New("one of the users blocks the other")
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block stores the block and removes the follows and follow requests between
+// the two users in both directions.
+func (s *BlockStore) Block(ctx context.Context, blockerId, blockedId int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		query := `INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		if _, err := tx.ExecContext(ctx, query, blockerId, blockedId); err != nil {
+			return err
+		}
+		query = `DELETE FROM followers WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)`
+		if _, err := tx.ExecContext(ctx, query, blockerId, blockedId); err != nil {
+			return err
+		}
+		query = `DELETE FROM follow_requests WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)`
+		_, err := tx.ExecContext(ctx, query, blockerId, blockedId)
+		return err
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerId, blockedId int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`, blockerId, blockedId)
+	return err
+}
+
+func (s *BlockStore) Mute(ctx context.Context, muterId, mutedId int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, muterId, mutedId)
+	return err
+}
+
+func (s *BlockStore) Unmute(ctx context.Context, muterId, mutedId int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2`, muterId, mutedId)
+	return err
+}
+
+// IsBlocked tells whether either user blocks the other.
+func (s *BlockStore) IsBlocked(ctx context.Context, userId, otherId int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT EXISTS (SELECT 1 FROM user_blocks WHERE ` + blockedBetween("$1", "$2") + `)`
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, query, userId, otherId).Scan(&blocked)
+	return blocked, err
+}
+
+// blockedBetween is the user_blocks condition matching a block between the
+// two users, in either direction.
+func blockedBetween(a, b string) string {
+	return "(blocker_id = " + a + " AND blocked_id = " + b + ") OR (blocker_id = " + b + " AND blocked_id = " + a + ")"
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestBlocks(t *testing.T) {
+	db := newTestDB(t)
+	blocks := &BlockStore{db: db}
+	followers := &FollowerStore{db: db}
+	posts := &PostStore{db: db}
+	comments := &CommentStore{db: db}
+	ctx := context.Background()
+
+	blocker := insertUser(t, db, "blocker")
+	blocked := insertUser(t, db, "blocked")
+	for _, f := range [][2]int64{{blocker, blocked}, {blocked, blocker}} {
+		if _, err := followers.Follow(ctx, f[0], f[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var postID int64
+	if err := db.QueryRow(`INSERT INTO posts (title, content, user_id) VALUES ('t', 'c', $1) RETURNING id`, blocker).Scan(&postID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := blocks.Block(ctx, blocker, blocked); err != nil {
+		t.Fatal(err)
+	}
+	// the block works both ways
+	for _, pair := range [][2]int64{{blocker, blocked}, {blocked, blocker}} {
+		if isBlocked, err := blocks.IsBlocked(ctx, pair[0], pair[1]); err != nil || !isBlocked {
+			t.Errorf("IsBlocked(%d, %d): got %v, %v", pair[0], pair[1], isBlocked, err)
+		}
+		if _, err := followers.Follow(ctx, pair[0], pair[1]); !errors.Is(err, ErrBlocked) {
+			t.Errorf("following across a block: got %v, want ErrBlocked", err)
+		}
+	}
+	var follows int
+	if err := db.QueryRow(`SELECT count(*) FROM followers`).Scan(&follows); err != nil {
+		t.Fatal(err)
+	}
+	if follows != 0 {
+		t.Errorf("got %d follows left after the block, want none", follows)
+	}
+
+	if post, err := posts.GetByID(ctx, postID, blocked); err != nil || post != nil {
+		t.Errorf("the blocked user got the post: %+v, %v", post, err)
+	}
+	err := comments.CreateComment(ctx, &Comment{PostID: int(postID), UserID: int(blocked), Content: "c"})
+	if !errors.Is(err, ErrPostNotVisible) {
+		t.Errorf("commenting across a block: got %v, want ErrPostNotVisible", err)
+	}
+
+	if err := blocks.Unblock(ctx, blocker, blocked); err != nil {
+		t.Fatal(err)
+	}
+	if isBlocked, err := blocks.IsBlocked(ctx, blocked, blocker); err != nil || isBlocked {
+		t.Errorf("after unblocking: got %v, %v", isBlocked, err)
+	}
+}
+
+func TestMutes(t *testing.T) {
+	db := newTestDB(t)
+	blocks := &BlockStore{db: db}
+	followers := &FollowerStore{db: db}
+	posts := &PostStore{db: db}
+	ctx := context.Background()
+
+	muter := insertUser(t, db, "muter")
+	loud := insertUser(t, db, "loud")
+	quiet := insertUser(t, db, "quiet")
+	for _, author := range []int64{loud, quiet} {
+		if _, err := followers.Follow(ctx, author, muter); err != nil {
+			t.Fatal(err)
+		}
+		mustExec(t, db, `INSERT INTO posts (title, content, user_id) VALUES ('t', 'c', $1)`, author)
+	}
+	if err := blocks.Mute(ctx, muter, loud); err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := posts.GetUserFeed(ctx, muter, PaginatedFeedQuery{Limit: 10, Sort: "desc", Match: "any"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*feed) != 1 || (*feed)[0].UserID != quiet {
+		t.Errorf("got feed %+v, want only the post of the user not muted", *feed)
+	}
+	ids, err := followers.GetFollowedIDs(ctx, muter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []int64{quiet}) {
+		t.Errorf("got followed %v, want %d", ids, quiet)
+	}
+	// muting hides, it does not unfollow
+	counts, err := followers.GetCounts(ctx, muter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Following != 2 {
+		t.Errorf("got counts %+v, want 2 following", counts)
+	}
+
+	if err := blocks.Unmute(ctx, muter, loud); err != nil {
+		t.Fatal(err)
+	}
+	if feed, err = posts.GetUserFeed(ctx, muter, PaginatedFeedQuery{Limit: 10, Sort: "desc", Match: "any"}); err != nil || len(*feed) != 2 {
+		t.Errorf("after unmuting: got feed %+v, %v, want both posts", feed, err)
+	}
+}
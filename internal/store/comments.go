@@ -3,86 +3,418 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 )
 
+var (
+	ErrInvalidParentComment = errors.New("parent comment does not belong to the post or is deleted")
+	ErrCommentNotFound      = errors.New("comment not found or deleted")
+)
+
 type Comment struct {
-	ID        int       `db:"id" json:"id"`
-	PostID    int       `db:"post_id" json:"post_id"`
-	UserID    int       `db:"user_id" json:"user_id"`
+	ID         int           `db:"id" json:"id"`
+	PostID     int           `db:"post_id" json:"post_id"`
+	UserID     int           `db:"user_id" json:"user_id"`
+	ParentID   *int64        `db:"parent_id" json:"parent_id"`
+	Content    string        `db:"content" json:"content"`
+	User       CommentAuthor `db:"user" json:"user"`
+	ReplyCount int           `db:"reply_count" json:"reply_count"`
+	Replies    []Comment     `db:"replies" json:"replies,omitempty"`
+	// RepliesNextCursor pages through the replies beyond the embedded ones,
+	// through the replies endpoint of this comment.
+	RepliesNextCursor string `db:"-" json:"replies_next_cursor,omitempty"`
+	// DeletedAt is set on soft deleted comments. They stay in threads so
+	// their replies keep their context, but their content is never returned.
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// CommentAuthor is the user shown with a comment in threads.
+type CommentAuthor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type CommentEdit struct {
+	ID        int64     `db:"id" json:"id"`
+	CommentID int       `db:"comment_id" json:"comment_id"`
 	Content   string    `db:"content" json:"content"`
-	User      User      `db:"user" json:"user"`
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	EditedBy  *int64    `db:"edited_by" json:"edited_by"`
+	EditedAt  time.Time `db:"edited_at" json:"edited_at"`
+}
+
+// ThreadOptions bounds how much of a comment tree is loaded: Depth levels in
+// total, and at most Replies replies per comment on each level below the
+// first.
+type ThreadOptions struct {
+	Depth   int
+	Replies int
 }
+
 type CommentStore struct {
 	db *sql.DB
 }
 
-func (s *CommentStore) GetCommentsWithPost(ctx context.Context, postID int64) (*[]Comment, error) {
-	query := `
-        SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, c.updated_at,
-       u.id, u.username, u.email, u.created_at, u.updated_at
-    FROM comments c
-    JOIN users u ON u.id = c.user_id
-  WHERE c.post_id = $1
-   ORDER BY c.created_at DESC
+// GetCommentsWithPost returns a page of the top-level comments of a post, each
+// with its first replies nested up to opts.Depth.
+func (s *CommentStore) GetCommentsWithPost(ctx context.Context, postID int64, fq PaginatedFeedQuery, opts ThreadOptions) (*[]Comment, error) {
+	return s.getThreads(ctx, "c.post_id = $1 AND c.parent_id IS NULL", postID, fq, opts)
+}
 
-    `
+// GetReplies returns a page of the direct replies of a comment, each with its
+// own first replies nested up to opts.Depth.
+func (s *CommentStore) GetReplies(ctx context.Context, commentID int64, fq PaginatedFeedQuery, opts ThreadOptions) (*[]Comment, error) {
+	return s.getThreads(ctx, "c.parent_id = $1", commentID, fq, opts)
+}
 
-	var comments []Comment
+func (s *CommentStore) getThreads(ctx context.Context, rootFilter string, rootArg int64, fq PaginatedFeedQuery, opts ThreadOptions) (*[]Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	args := []interface{}{rootArg, opts.Depth, opts.Replies}
+	where, orderBy, keysetArgs := fq.keyset("c.created_at", "c.id", len(args)+1)
+	roots := "SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.deleted_at, c.created_at, c.updated_at, " +
+		"ROW_NUMBER() OVER (ORDER BY " + orderBy + ") AS pos FROM comments c WHERE " + rootFilter
+	if where != "" {
+		roots += " AND " + where
+		args = append(args, keysetArgs...)
+	}
+	roots += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", orderBy, len(args)+1, len(args)+2)
+	args = append(args, fq.Limit, fq.Offset)
+
+	// Replies below the roots are always oldest first, and every level is
+	// limited per parent through the lateral join. Replies keep the pos of
+	// their root, so ordering by depth and pos keeps every level in order.
+	query := `
+WITH RECURSIVE roots AS (` + roots + `),
+tree AS (
+    SELECT r.*, 1 AS depth FROM roots r
+    UNION ALL
+    SELECT ch.*, t.pos, t.depth + 1 FROM tree t
+    CROSS JOIN LATERAL (
+        SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.deleted_at, c.created_at, c.updated_at
+        FROM comments c
+        WHERE c.parent_id = t.id
+        ORDER BY c.created_at ASC, c.id ASC
+        LIMIT $3
+    ) ch
+    WHERE t.depth < $2
+),
+reply_counts AS (
+    SELECT c.parent_id, COUNT(*) AS reply_count
+    FROM comments c
+    WHERE c.parent_id IN (SELECT id FROM tree)
+    GROUP BY c.parent_id
+)
+SELECT t.id, t.post_id, t.user_id, t.parent_id,
+       CASE WHEN t.deleted_at IS NULL THEN t.content ELSE '' END, t.deleted_at, t.created_at, t.updated_at,
+       COALESCE(rc.reply_count, 0), t.depth,
+       u.id, u.username
+FROM tree t
+JOIN users u ON u.id = t.user_id
+LEFT JOIN reply_counts rc ON rc.parent_id = t.id
+ORDER BY t.depth, t.pos, t.created_at, t.id
+`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	// rows come level by level, so every parent is seen before its replies
+	var flat []*Comment
+	byID := map[int]*Comment{}
 	for rows.Next() {
-		var comment Comment
-		var user User
-
+		comment := &Comment{}
+		var depth int
 		err := rows.Scan(
 			&comment.ID,
 			&comment.PostID,
 			&comment.UserID,
+			&comment.ParentID,
 			&comment.Content,
+			&comment.DeletedAt,
 			&comment.CreatedAt,
 			&comment.UpdatedAt,
-			&user.ID,
-			&user.Username,
-			&user.Email,
-			&user.CreatedAt,
-			&user.UpdatedAt,
+			&comment.ReplyCount,
+			&depth,
+			&comment.User.ID,
+			&comment.User.Username,
 		)
-
 		if err != nil {
 			return nil, err
 		}
-
-		comment.User = user
-		comments = append(comments, comment)
+		flat = append(flat, comment)
+		byID[comment.ID] = comment
 	}
-
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return &comments, nil
+	return buildThreads(flat, byID, opts), nil
+}
+
+// buildThreads nests the comments under their parents. Building bottom-up
+// means every reply is complete before it is copied into its parent.
+func buildThreads(flat []*Comment, byID map[int]*Comment, opts ThreadOptions) *[]Comment {
+	children := map[int][]*Comment{}
+	roots := []*Comment{}
+	for _, c := range flat {
+		if c.ParentID != nil {
+			if _, ok := byID[int(*c.ParentID)]; ok {
+				children[int(*c.ParentID)] = append(children[int(*c.ParentID)], c)
+				continue
+			}
+		}
+		roots = append(roots, c)
+	}
+	for i := len(flat) - 1; i >= 0; i-- {
+		c := flat[i]
+		for _, child := range children[c.ID] {
+			c.Replies = append(c.Replies, *child)
+		}
+		if n := len(c.Replies); n > 0 && n < c.ReplyCount {
+			last := c.Replies[n-1]
+			c.RepliesNextCursor = Cursor{CreatedAt: last.CreatedAt, ID: int64(last.ID)}.Encode()
+		}
+	}
+	comments := make([]Comment, 0, len(roots))
+	for _, c := range roots {
+		comments = append(comments, *c)
+	}
+	return &comments
 }
 
 func (s *CommentStore) CreateComment(ctx context.Context, comment *Comment) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	// users cannot comment on the posts they are not allowed to see
+	var hidden bool
+	err := s.db.QueryRowContext(ctx, `SELECT NOT `+postVisibleTo("p", "$2")+` FROM posts p WHERE p.id = $1`, comment.PostID, comment.UserID).Scan(&hidden)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if hidden {
+		return ErrPostNotVisible
+	}
+
+	// a reply is only inserted when its parent is on the same post and not deleted
 	query := `
-        INSERT INTO comments (post_id, user_id, content, created_at, updated_at)
-        VALUES ($1, $2, $3, NOW(), NOW())
-        RETURNING id
+        INSERT INTO comments (post_id, user_id, parent_id, content, created_at, updated_at)
+        SELECT $1, $2, $3, $4, NOW(), NOW()
+        WHERE $3::int IS NULL OR EXISTS (SELECT 1 FROM comments WHERE id = $3 AND post_id = $1 AND deleted_at IS NULL)
+        RETURNING id, created_at, updated_at
     `
 
-	// If you want to get the generated ID
-	err := s.db.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content).Scan(&comment.ID)
-	if err != nil {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.ParentID, comment.Content).Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidParentComment
+			}
+			return err
+		}
+		commentID := int64(comment.ID)
+		if err := syncEntities(ctx, tx, commentEntities, commentID, int64(comment.PostID), int64(comment.UserID), &commentID, comment.Content); err != nil {
+			return err
+		}
+		if err := notifyComment(ctx, tx, comment); err != nil {
+			return err
+		}
+		return publish(ctx, tx, CommentsTopic(int64(comment.PostID)), StreamComment, streamComment{
+			ID:        commentID,
+			PostID:    int64(comment.PostID),
+			UserID:    int64(comment.UserID),
+			ParentID:  comment.ParentID,
+			Content:   comment.Content,
+			CreatedAt: comment.CreatedAt,
+		})
+	})
+}
+
+// notifyComment tells the author of the post about a new comment, and the
+// author of the parent about a reply. Authors replied to on their own post only
+// get the reply.
+func notifyComment(ctx context.Context, tx *sql.Tx, comment *Comment) error {
+	postID, commentID := int64(comment.PostID), int64(comment.ID)
+	var postAuthor int64
+	var parentAuthor sql.NullInt64
+	query := `SELECT p.user_id, (SELECT user_id FROM comments WHERE id = $2) FROM posts p WHERE p.id = $1`
+	if err := tx.QueryRowContext(ctx, query, postID, comment.ParentID).Scan(&postAuthor, &parentAuthor); err != nil {
 		return err
 	}
+	if parentAuthor.Valid {
+		err := raise(ctx, tx, Event{
+			Type:      NotificationReply,
+			UserID:    parentAuthor.Int64,
+			ActorID:   int64(comment.UserID),
+			PostID:    &postID,
+			CommentID: &commentID,
+			GroupKey:  fmt.Sprintf("reply:comment:%d", *comment.ParentID),
+		})
+		if err != nil || parentAuthor.Int64 == postAuthor {
+			return err
+		}
+	}
+	return raise(ctx, tx, Event{
+		Type:      NotificationComment,
+		UserID:    postAuthor,
+		ActorID:   int64(comment.UserID),
+		PostID:    &postID,
+		CommentID: &commentID,
+		GroupKey:  fmt.Sprintf("comment:post:%d", postID),
+	})
+}
+
+// GetByID returns the comment when it is not deleted and the viewer may see
+// its post.
+func (s *CommentStore) GetByID(ctx context.Context, id int64, viewerId int64) (*Comment, error) {
+	return s.getByID(ctx, id, viewerId, false)
+}
+
+// GetByIDIncludingDeleted is GetByID for deleted comments too, for their edit
+// history and the replies below their placeholder in threads.
+func (s *CommentStore) GetByIDIncludingDeleted(ctx context.Context, id int64, viewerId int64) (*Comment, error) {
+	return s.getByID(ctx, id, viewerId, true)
+}
+
+func (s *CommentStore) getByID(ctx context.Context, id int64, viewerId int64, includeDeleted bool) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.deleted_at, c.created_at, c.updated_at
+	FROM comments c JOIN posts p ON p.id = c.post_id
+	WHERE c.id = $1 AND ($3 OR c.deleted_at IS NULL) AND ` + postVisibleTo("p", "$2")
+	comment := &Comment{}
+	err := s.db.QueryRowContext(ctx, query, id, viewerId, includeDeleted).Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.ParentID, &comment.Content, &comment.DeletedAt, &comment.CreatedAt, &comment.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return comment, nil
+}
+
+// Update changes the content of a comment and keeps the previous content in
+// comment_edits.
+func (s *CommentStore) Update(ctx context.Context, commentID int64, content string, editorID int64) (*Comment, error) {
+	comment := &Comment{}
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		query := `INSERT INTO comment_edits (comment_id, content, edited_by)
+		SELECT id, content, $2 FROM comments WHERE id = $1 AND deleted_at IS NULL`
+		result, err := tx.ExecContext(ctx, query, commentID, editorID)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrCommentNotFound
+		}
+		query = `UPDATE comments SET content = $2, updated_at = NOW() WHERE id = $1
+		RETURNING id, post_id, user_id, parent_id, content, created_at, updated_at`
+		err = tx.QueryRowContext(ctx, query, commentID, content).Scan(
+			&comment.ID, &comment.PostID, &comment.UserID, &comment.ParentID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		return syncEntities(ctx, tx, commentEntities, commentID, int64(comment.PostID), int64(comment.UserID), &commentID, comment.Content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
 
+// Delete soft deletes a comment, its replies are kept.
+func (s *CommentStore) Delete(ctx context.Context, commentID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `UPDATE comments SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+	result, err := s.db.ExecContext(ctx, query, commentID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrCommentNotFound
+	}
 	return nil
 }
+
+// GetEdits returns the previous versions of a comment, oldest first.
+func (s *CommentStore) GetEdits(ctx context.Context, commentID int64) ([]CommentEdit, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT id, comment_id, content, edited_by, edited_at FROM comment_edits WHERE comment_id = $1 ORDER BY edited_at, id`
+	rows, err := s.db.QueryContext(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := []CommentEdit{}
+	for rows.Next() {
+		edit := CommentEdit{}
+		if err := rows.Scan(&edit.ID, &edit.CommentID, &edit.Content, &edit.EditedBy, &edit.EditedAt); err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
+
+// GetByUser returns a page of the comments a user wrote, without the deleted
+// ones and the ones on posts the viewer may not see.
+func (s *CommentStore) GetByUser(ctx context.Context, userID int64, viewerId int64, fq PaginatedFeedQuery) (*[]Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.created_at, c.updated_at
+	FROM comments c
+	JOIN posts p ON p.id = c.post_id
+	WHERE c.user_id = $1 AND c.deleted_at IS NULL AND ` + postVisibleTo("p", "$2")
+	args := []interface{}{userID, viewerId}
+	where, orderBy, keysetArgs := fq.keyset("c.created_at", "c.id", len(args)+1)
+	if where != "" {
+		query += " AND " + where
+		args = append(args, keysetArgs...)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", orderBy, len(args)+1, len(args)+2)
+	args = append(args, fq.Limit, fq.Offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		comment := Comment{}
+		err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.ParentID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &comments, nil
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDeletedComments(t *testing.T) {
+	db := newTestDB(t)
+	comments := &CommentStore{db: db}
+	posts := &PostStore{db: db}
+	ctx := context.Background()
+
+	author := insertUser(t, db, "author")
+	var postID, kept, deleted int64
+	if err := db.QueryRow(`INSERT INTO posts (title, content, user_id) VALUES ('t', 'c', $1) RETURNING id`, author).Scan(&postID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []*int64{&kept, &deleted} {
+		if err := db.QueryRow(`INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, 'c') RETURNING id`, postID, author).Scan(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := comments.Delete(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := comments.GetByID(ctx, kept, author); err != nil || c == nil {
+		t.Errorf("GetByID of a comment: got %v, %v", c, err)
+	}
+	if c, err := comments.GetByID(ctx, deleted, author); err != nil || c != nil {
+		t.Errorf("GetByID of a deleted comment: got %+v, %v, want not found", c, err)
+	}
+	c, err := comments.GetByIDIncludingDeleted(ctx, deleted, author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || c.DeletedAt == nil {
+		t.Errorf("GetByIDIncludingDeleted of a deleted comment: got %+v", c)
+	}
+
+	feed, err := posts.GetUserFeed(ctx, author, PaginatedFeedQuery{Limit: 10, Sort: "desc", Match: "any"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*feed) != 1 || (*feed)[0].CommentCount != 1 {
+		t.Errorf("got feed %+v, want the post with its one comment that is not deleted", *feed)
+	}
+}
@@ -3,7 +3,16 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAlreadyFollowing      = errors.New("you already followed")
+	ErrFollowRequestNotFound = errors.New("follow request not found")
 )
 
 type FollowerStore struct {
@@ -16,23 +25,244 @@ type Follower struct {
 	CreatedAt  time.Time `db:"created_at" json:"created_at"`
 }
 
-func (s *FollowerStore) Follow(ctx context.Context, userId int64, followerId int64) error {
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-	query := `INSERT INTO followers (user_id,follower_id) VALUES ($1,$2)`
-	_, err := s.db.ExecContext(ctx, query, userId, followerId)
+// FollowUser is one entry of a followers or following list. IsMutual tells
+// whether the listed user and the owner of the list follow each other, and
+// ViewerFollows whether the authenticated user follows the listed user.
+type FollowUser struct {
+	ID            int64     `json:"id"`
+	Username      string    `json:"username"`
+	FollowedAt    time.Time `json:"followed_at"`
+	IsMutual      bool      `json:"is_mutual"`
+	ViewerFollows bool      `json:"viewer_follows"`
+}
+
+type FollowCounts struct {
+	Followers int `json:"followers_count"`
+	Following int `json:"following_count"`
+}
+
+// Follow records that followerId follows userId. When userId is a private
+// account a pending follow request is stored instead and requested is true.
+// It returns ErrBlocked when either user blocks the other, and
+// ErrAlreadyFollowing when followerId already follows userId.
+func (s *FollowerStore) Follow(ctx context.Context, userId int64, followerId int64) (requested bool, err error) {
+	err = withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var blocked, private, following bool
+		query := `SELECT
+		EXISTS (SELECT 1 FROM user_blocks WHERE ` + blockedBetween("$1::bigint", "$2::bigint") + `),
+		(SELECT is_private FROM users WHERE id = $1),
+		EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`
+		if err := tx.QueryRowContext(ctx, query, userId, followerId).Scan(&blocked, &private, &following); err != nil {
+			return err
+		}
+		event := Event{Type: NotificationFollow, UserID: userId, ActorID: followerId, GroupKey: NotificationFollow}
+		switch {
+		case blocked:
+			return ErrBlocked
+		case following:
+			return ErrAlreadyFollowing
+		case private:
+			requested = true
+			event.Type, event.GroupKey = NotificationFollowRequest, NotificationFollowRequest
+			query = `INSERT INTO follow_requests (user_id, requester_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		default:
+			query = `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`
+		}
+		result, err := tx.ExecContext(ctx, query, userId, followerId)
+		if err != nil {
+			return err
+		}
+		// asking again for a pending request notifies nobody
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		return raise(ctx, tx, event)
+	})
+	return requested, err
+}
+
+// UnFOllow removes the follow, or cancels the pending follow request, of
+// unFOllowerId on userId.
+func (s *FollowerStore) UnFOllow(ctx context.Context, userId int64, unFOllowerId int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
+		if _, err := tx.ExecContext(ctx, query, userId, unFOllowerId); err != nil {
+			return err
+		}
+		query = `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`
+		_, err := tx.ExecContext(ctx, query, userId, unFOllowerId)
+		return err
+	})
+}
+
+// GetRequests returns a page of the pending follow requests sent to userId.
+func (s *FollowerStore) GetRequests(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]FollowUser, error) {
+	query := `
+SELECT u.id, u.username, f.created_at, false, v.user_id IS NOT NULL
+FROM follow_requests f
+JOIN users u ON u.id = f.requester_id
+LEFT JOIN followers v ON v.user_id = f.requester_id AND v.follower_id = $2
+WHERE f.user_id = $1`
+	return s.list(ctx, query, "f.requester_id", userId, userId, fq)
+}
+
+// ApproveRequest turns the pending request of requesterId into a follow of
+// userId.
+func (s *FollowerStore) ApproveRequest(ctx context.Context, userId int64, requesterId int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		if err := deleteFollowRequest(ctx, tx, userId, requesterId); err != nil {
+			return err
+		}
+		query := `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		_, err := tx.ExecContext(ctx, query, userId, requesterId)
+		return err
+	})
+}
+
+func (s *FollowerStore) RejectRequest(ctx context.Context, userId int64, requesterId int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		return deleteFollowRequest(ctx, tx, userId, requesterId)
+	})
+}
+
+func deleteFollowRequest(ctx context.Context, tx *sql.Tx, userId int64, requesterId int64) error {
+	result, err := tx.ExecContext(ctx, `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`, userId, requesterId)
 	if err != nil {
 		return err
 	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrFollowRequestNotFound
+	}
 	return nil
 }
-func (s *FollowerStore) UnFOllow(ctx context.Context, userId int64, unFOllowerId int64) error {
+
+// GetFollowers returns a page of the users following userId.
+func (s *FollowerStore) GetFollowers(ctx context.Context, userId int64, viewerId int64, fq PaginatedFeedQuery) ([]FollowUser, error) {
+	query := `
+SELECT u.id, u.username, f.created_at, m.user_id IS NOT NULL, v.user_id IS NOT NULL
+FROM followers f
+JOIN users u ON u.id = f.follower_id
+LEFT JOIN followers m ON m.user_id = f.follower_id AND m.follower_id = f.user_id
+LEFT JOIN followers v ON v.user_id = f.follower_id AND v.follower_id = $2
+WHERE f.user_id = $1`
+	return s.list(ctx, query, "f.follower_id", userId, viewerId, fq)
+}
+
+// GetFollowing returns a page of the users userId follows.
+func (s *FollowerStore) GetFollowing(ctx context.Context, userId int64, viewerId int64, fq PaginatedFeedQuery) ([]FollowUser, error) {
+	query := `
+SELECT u.id, u.username, f.created_at, m.user_id IS NOT NULL, v.user_id IS NOT NULL
+FROM followers f
+JOIN users u ON u.id = f.user_id
+LEFT JOIN followers m ON m.user_id = f.follower_id AND m.follower_id = f.user_id
+LEFT JOIN followers v ON v.user_id = f.user_id AND v.follower_id = $2
+WHERE f.follower_id = $1`
+	return s.list(ctx, query, "f.user_id", userId, viewerId, fq)
+}
+
+func (s *FollowerStore) list(ctx context.Context, query, idCol string, userId, viewerId int64, fq PaginatedFeedQuery) ([]FollowUser, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
-	_, err := s.db.ExecContext(ctx, query, userId, unFOllowerId)
+	args := []interface{}{userId, viewerId}
+	where, orderBy, keysetArgs := fq.keyset("f.created_at", idCol, len(args)+1)
+	if where != "" {
+		query += " AND " + where
+		args = append(args, keysetArgs...)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", orderBy, len(args)+1, len(args)+2)
+	args = append(args, fq.Limit, fq.Offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+
+	users := []FollowUser{}
+	for rows.Next() {
+		u := FollowUser{}
+		if err := rows.Scan(&u.ID, &u.Username, &u.FollowedAt, &u.IsMutual, &u.ViewerFollows); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *FollowerStore) GetCounts(ctx context.Context, userId int64) (*FollowCounts, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT
+	(SELECT COUNT(*) FROM followers WHERE user_id = $1),
+	(SELECT COUNT(*) FROM followers WHERE follower_id = $1)`
+	counts := &FollowCounts{}
+	if err := s.db.QueryRowContext(ctx, query, userId).Scan(&counts.Followers, &counts.Following); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetFollowedIDs returns the IDs of the users userId follows and has not muted,
+// the authors whose new posts reach the user.
+func (s *FollowerStore) GetFollowedIDs(ctx context.Context, userId int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT f.user_id FROM followers f
+	WHERE f.follower_id = $1 AND NOT EXISTS (SELECT 1 FROM user_mutes WHERE muter_id = $1 AND muted_id = f.user_id)`
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetRelation tells whether either user blocks the other and whether viewerId
+// follows userId.
+func (s *FollowerStore) GetRelation(ctx context.Context, userId int64, viewerId int64) (Relation, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT
+	EXISTS (SELECT 1 FROM user_blocks WHERE ` + blockedBetween("$1::bigint", "$2::bigint") + `),
+	EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`
+	var rel Relation
+	err := s.db.QueryRowContext(ctx, query, userId, viewerId).Scan(&rel.Blocked, &rel.Following)
+	return rel, err
+}
+
+// FilterFollowers returns those of ids that follow userId and have not muted
+// them, like GetFollowedIDs seen from the author.
+func (s *FollowerStore) FilterFollowers(ctx context.Context, userId int64, ids []int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT COALESCE(array_agg(f.follower_id), '{}') FROM followers f
+	WHERE f.user_id = $1 AND f.follower_id = ANY($2)
+	AND NOT EXISTS (SELECT 1 FROM user_mutes WHERE muter_id = f.follower_id AND muted_id = $1)`
+	var followers pq.Int64Array
+	err := s.db.QueryRowContext(ctx, query, userId, pq.Array(ids)).Scan(&followers)
+	return followers, err
 }
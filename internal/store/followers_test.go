@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFollowLists(t *testing.T) {
+	db := newTestDB(t)
+	s := &FollowerStore{db: db}
+	ctx := context.Background()
+
+	owner := insertUser(t, db, "owner")
+	mutual := insertUser(t, db, "mutual")
+	fan := insertUser(t, db, "fan")
+	viewer := insertUser(t, db, "viewer")
+	follow := func(userId, followerId int64) {
+		t.Helper()
+		if _, err := s.Follow(ctx, userId, followerId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	follow(owner, mutual)
+	follow(mutual, owner)
+	follow(owner, fan)
+	follow(fan, viewer)
+	if _, err := s.Follow(ctx, owner, fan); !errors.Is(err, ErrAlreadyFollowing) {
+		t.Errorf("following twice: got %v, want ErrAlreadyFollowing", err)
+	}
+
+	followers, err := s.GetFollowers(ctx, owner, viewer, PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// newest follower first
+	if len(followers) != 2 || followers[0].ID != fan || followers[1].ID != mutual {
+		t.Fatalf("got followers %+v, want fan and mutual", followers)
+	}
+	if followers[0].IsMutual || !followers[0].ViewerFollows {
+		t.Errorf("got fan %+v, want not mutual and followed by the viewer", followers[0])
+	}
+	if !followers[1].IsMutual || followers[1].ViewerFollows {
+		t.Errorf("got mutual %+v, want mutual and not followed by the viewer", followers[1])
+	}
+
+	following, err := s.GetFollowing(ctx, owner, viewer, PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(following) != 1 || following[0].ID != mutual || !following[0].IsMutual {
+		t.Errorf("got following %+v, want mutual", following)
+	}
+
+	// the second page starts after the first follower
+	first, err := s.GetFollowers(ctx, owner, viewer, PaginatedFeedQuery{Limit: 1, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := &Cursor{CreatedAt: first[0].FollowedAt, ID: first[0].ID}
+	second, err := s.GetFollowers(ctx, owner, viewer, PaginatedFeedQuery{Limit: 1, Sort: "desc", After: after})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 1 || second[0].ID != mutual {
+		t.Errorf("got second page %+v, want mutual", second)
+	}
+
+	counts, err := s.GetCounts(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Followers != 2 || counts.Following != 1 {
+		t.Errorf("got counts %+v, want 2 followers and 1 following", counts)
+	}
+
+	if err := s.UnFOllow(ctx, owner, fan); err != nil {
+		t.Fatal(err)
+	}
+	if counts, err = s.GetCounts(ctx, owner); err != nil || counts.Followers != 1 {
+		t.Errorf("after unfollowing: got counts %+v, %v, want 1 follower", counts, err)
+	}
+}
+
+func TestFollowRequests(t *testing.T) {
+	db := newTestDB(t)
+	s := &FollowerStore{db: db}
+	ctx := context.Background()
+
+	private := insertUser(t, db, "private")
+	approved := insertUser(t, db, "approved")
+	rejected := insertUser(t, db, "rejected")
+	cancelled := insertUser(t, db, "cancelled")
+	mustExec(t, db, `UPDATE users SET is_private = true WHERE id = $1`, private)
+
+	for _, requester := range []int64{approved, rejected, cancelled} {
+		requested, err := s.Follow(ctx, private, requester)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !requested {
+			t.Errorf("following a private account: got a follow, want a request")
+		}
+	}
+	// asking again keeps the one request
+	if requested, err := s.Follow(ctx, private, approved); err != nil || !requested {
+		t.Errorf("asking again: got %v, %v", requested, err)
+	}
+	requests, err := s.GetRequests(ctx, private, PaginatedFeedQuery{Limit: 10, Sort: "asc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 3 || requests[0].ID != approved {
+		t.Fatalf("got requests %+v, want the 3 requesters", requests)
+	}
+
+	if err := s.ApproveRequest(ctx, private, approved); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RejectRequest(ctx, private, rejected); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UnFOllow(ctx, private, cancelled); err != nil {
+		t.Fatal(err)
+	}
+	for _, requester := range []int64{approved, rejected, cancelled} {
+		if err := s.ApproveRequest(ctx, private, requester); !errors.Is(err, ErrFollowRequestNotFound) {
+			t.Errorf("approving a request already handled: got %v, want ErrFollowRequestNotFound", err)
+		}
+	}
+
+	rel, err := s.GetRelation(ctx, private, approved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rel.Following {
+		t.Error("the approved requester does not follow")
+	}
+	counts, err := s.GetCounts(ctx, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Followers != 1 {
+		t.Errorf("got counts %+v, want the approved follower only", counts)
+	}
+	if requests, err = s.GetRequests(ctx, private, PaginatedFeedQuery{Limit: 10, Sort: "asc"}); err != nil || len(requests) != 0 {
+		t.Errorf("got requests %+v, %v, want none left", requests, err)
+	}
+
+	// one notification for all the requests
+	var notifications, actors int
+	err = db.QueryRow(`SELECT count(*), coalesce(sum(actor_count), 0) FROM notifications WHERE user_id = $1 AND type = $2`,
+		private, NotificationFollowRequest).Scan(&notifications, &actors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notifications != 1 || actors != 3 {
+		t.Errorf("got %d notifications of %d actors, want 1 of 3", notifications, actors)
+	}
+}
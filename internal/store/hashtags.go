@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// a hashtag needs at least one letter, so "#1" is not a tag
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#])#([\p{L}\p{N}_]*\p{L}[\p{L}\p{N}_]*)`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_.\-]+)`)
+)
+
+const maxEntityLength = 100
+
+// extractHashtags returns the lower-cased hashtags of text, without duplicates.
+func extractHashtags(text string) []string {
+	return extract(hashtagPattern, text, strings.ToLower)
+}
+
+// extractMentions returns the usernames mentioned in text, without duplicates.
+func extractMentions(text string) []string {
+	return extract(mentionPattern, text, func(s string) string {
+		return strings.TrimRight(s, ".-")
+	})
+}
+
+func extract(pattern *regexp.Regexp, text string, normalize func(string) string) []string {
+	seen := map[string]bool{}
+	found := []string{}
+	for _, m := range pattern.FindAllStringSubmatch(text, -1) {
+		v := normalize(m[1])
+		if v == "" || utf8.RuneCountInString(v) > maxEntityLength || seen[v] {
+			continue
+		}
+		seen[v] = true
+		found = append(found, v)
+	}
+	return found
+}
+
+// mergeTags appends the hashtags missing from tags.
+func mergeTags(tags, hashtags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		seen[strings.ToLower(t)] = true
+	}
+	for _, h := range hashtags {
+		if !seen[h] {
+			tags = append(tags, h)
+			seen[h] = true
+		}
+	}
+	return tags
+}
+
+// entityTables names the tables holding the hashtags and mentions of posts or
+// of comments.
+type entityTables struct {
+	hashtags string
+	mentions string
+	idCol    string
+}
+
+var (
+	postEntities    = entityTables{hashtags: "post_hashtags", mentions: "post_mentions", idCol: "post_id"}
+	commentEntities = entityTables{hashtags: "comment_hashtags", mentions: "comment_mentions", idCol: "comment_id"}
+)
+
+// syncEntities stores the hashtags and mentions of text for the post or
+// comment id, replacing the previous ones. Users mentioned for the first time
+// get a notification, unless they may not see the post.
+func syncEntities(ctx context.Context, tx *sql.Tx, t entityTables, id, postID, authorID int64, commentID *int64, text string) error {
+	hashtags := extractHashtags(text)
+	mentions := extractMentions(text)
+
+	query := `INSERT INTO hashtags (name) SELECT unnest($1::varchar[]) ON CONFLICT (name) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(hashtags)); err != nil {
+		return err
+	}
+	query = fmt.Sprintf(`DELETE FROM %[1]s WHERE %[2]s = $1
+	AND hashtag_id NOT IN (SELECT id FROM hashtags WHERE name = ANY($2::varchar[]))`, t.hashtags, t.idCol)
+	if _, err := tx.ExecContext(ctx, query, id, pq.Array(hashtags)); err != nil {
+		return err
+	}
+	query = fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, hashtag_id)
+	SELECT $1, id FROM hashtags WHERE name = ANY($2::varchar[]) ON CONFLICT DO NOTHING`, t.hashtags, t.idCol)
+	if _, err := tx.ExecContext(ctx, query, id, pq.Array(hashtags)); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`DELETE FROM %[1]s WHERE %[2]s = $1
+	AND user_id NOT IN (SELECT id FROM users WHERE username = ANY($2::varchar[]))`, t.mentions, t.idCol)
+	if _, err := tx.ExecContext(ctx, query, id, pq.Array(mentions)); err != nil {
+		return err
+	}
+	query = fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, user_id)
+	SELECT $1, id FROM users WHERE username = ANY($2::varchar[]) AND id <> $3
+	ON CONFLICT DO NOTHING
+	RETURNING user_id`, t.mentions, t.idCol)
+	rows, err := tx.QueryContext(ctx, query, id, pq.Array(mentions), authorID)
+	if err != nil {
+		return err
+	}
+	var mentioned []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		mentioned = append(mentioned, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, userID := range mentioned {
+		err := raise(ctx, tx, Event{
+			Type:      NotificationMention,
+			UserID:    userID,
+			ActorID:   authorID,
+			PostID:    &postID,
+			CommentID: commentID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type TrendingTag struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type HashtagStore struct {
+	db *sql.DB
+}
+
+// GetTrending counts the uses of hashtags in posts and comments created within
+// the last window. Only posts anyone may list are counted.
+func (s *HashtagStore) GetTrending(ctx context.Context, window time.Duration, limit int) ([]TrendingTag, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+SELECT h.name, COUNT(*) AS uses
+FROM (
+    SELECT ph.hashtag_id FROM post_hashtags ph
+    JOIN posts p ON p.id = ph.post_id
+    WHERE ph.created_at >= $1 AND ` + postListedTo("p", "0") + `
+    UNION ALL
+    SELECT ch.hashtag_id FROM comment_hashtags ch
+    JOIN comments c ON c.id = ch.comment_id
+    JOIN posts p ON p.id = c.post_id
+    WHERE ch.created_at >= $1 AND c.deleted_at IS NULL AND ` + postListedTo("p", "0") + `
+) uses
+JOIN hashtags h ON h.id = uses.hashtag_id
+GROUP BY h.name
+ORDER BY uses DESC, h.name
+LIMIT $2`
+	rows, err := s.db.QueryContext(ctx, query, time.Now().Add(-window), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []TrendingTag{}
+	for rows.Next() {
+		t := TrendingTag{}
+		if err := rows.Scan(&t.Tag, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidAttachment is returned when a post is created with media that does
+// not exist, belongs to another user or is already attached to a post.
+var ErrInvalidAttachment = errors.New("attachments must be unused uploads of the author")
+
+// Processing states of media. Images are pending until their variants are
+// made, other media is ready right away.
+const (
+	MediaPending = "pending"
+	MediaReady   = "ready"
+	MediaFailed  = "failed"
+)
+
+// Media is an uploaded file. Key names the blob in the blob store and URL is
+// a signed URL filled in by the API before the media is returned, once it is
+// ready.
+type Media struct {
+	ID          int64          `json:"id"`
+	UserID      int64          `json:"user_id"`
+	PostID      *int64         `json:"post_id,omitempty"`
+	Key         string         `json:"-"`
+	ContentType string         `json:"content_type"`
+	Size        int64          `json:"size"`
+	Status      string         `json:"status"`
+	Width       int            `json:"width,omitempty"`
+	Height      int            `json:"height,omitempty"`
+	Blurhash    string         `json:"blurhash,omitempty"`
+	Variants    []MediaVariant `json:"variants"`
+	URL         string         `json:"url,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// MediaVariant is a resized copy of an image, like its thumbnail.
+type MediaVariant struct {
+	Name        string `json:"name"`
+	Key         string `json:"-"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url,omitempty"`
+}
+
+// variantRecord is how a MediaVariant is kept in the variants column, with
+// its key.
+type variantRecord struct {
+	Name        string `json:"name"`
+	Key         string `json:"key"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+type MediaStore struct {
+	db *sql.DB
+}
+
+const mediaColumns = `id, user_id, post_id, storage_key, content_type, size, status,
+	COALESCE(width, 0), COALESCE(height, 0), COALESCE(blurhash, ''), variants, created_at`
+
+func scanMedia(row interface{ Scan(...any) error }) (Media, error) {
+	m := Media{}
+	var variants []byte
+	err := row.Scan(&m.ID, &m.UserID, &m.PostID, &m.Key, &m.ContentType, &m.Size, &m.Status,
+		&m.Width, &m.Height, &m.Blurhash, &variants, &m.CreatedAt)
+	if err != nil {
+		return m, err
+	}
+	var records []variantRecord
+	if err := json.Unmarshal(variants, &records); err != nil {
+		return m, err
+	}
+	m.Variants = make([]MediaVariant, len(records))
+	for i, r := range records {
+		m.Variants[i] = MediaVariant{Name: r.Name, Key: r.Key, Width: r.Width, Height: r.Height, ContentType: r.ContentType, Size: r.Size}
+	}
+	return m, nil
+}
+
+// Create stores an upload. When process is set the media stays pending and
+// the message is enqueued in the same transaction to make its variants.
+func (s *MediaStore) Create(ctx context.Context, media *Media, process *OutboxMessage) error {
+	media.Status = MediaReady
+	if process != nil {
+		media.Status = MediaPending
+	}
+	media.Variants = []MediaVariant{}
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		query := `INSERT INTO media (user_id, storage_key, content_type, size, status) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+		err := tx.QueryRowContext(ctx, query, media.UserID, media.Key, media.ContentType, media.Size, media.Status).Scan(&media.ID, &media.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if process == nil {
+			return nil
+		}
+		return enqueueOutbox(ctx, tx, process)
+	})
+}
+
+func (s *MediaStore) GetByKey(ctx context.Context, key string) (*Media, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	m, err := scanMedia(s.db.QueryRowContext(ctx, `SELECT `+mediaColumns+` FROM media WHERE storage_key = $1`, key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SetProcessed stores the results of processing and marks the media ready.
+func (s *MediaStore) SetProcessed(ctx context.Context, media *Media) error {
+	records := make([]variantRecord, len(media.Variants))
+	for i, v := range media.Variants {
+		records[i] = variantRecord{v.Name, v.Key, v.Width, v.Height, v.ContentType, v.Size}
+	}
+	variants, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `UPDATE media SET status = $2, size = $3, width = $4, height = $5, blurhash = $6, variants = $7 WHERE id = $1`
+	_, err = s.db.ExecContext(ctx, query, media.ID, MediaReady, media.Size, media.Width, media.Height, media.Blurhash, variants)
+	return err
+}
+
+func (s *MediaStore) SetFailed(ctx context.Context, mediaID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `UPDATE media SET status = $2 WHERE id = $1`, mediaID, MediaFailed)
+	return err
+}
+
+// attachMedia attaches the media of ids to the post, in the order of ids, and
+// returns them.
+func attachMedia(ctx context.Context, tx *sql.Tx, postID, userID int64, ids []int64) ([]Media, error) {
+	query := `
+UPDATE media SET post_id = $1, position = array_position($2::bigint[], id)
+WHERE id = ANY($2) AND user_id = $3 AND post_id IS NULL AND status <> '` + MediaFailed + `'
+RETURNING ` + mediaColumns
+	rows, err := tx.QueryContext(ctx, query, postID, pq.Array(ids), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byID := map[int64]Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		byID[m.ID] = m
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(byID) != len(ids) {
+		return nil, ErrInvalidAttachment
+	}
+	media := make([]Media, len(ids))
+	for i, id := range ids {
+		media[i] = byID[id]
+	}
+	return media, nil
+}
+
+// attachPostMedia loads the attachments of the posts in byID.
+func attachPostMedia(ctx context.Context, db *sql.DB, byID map[int64]*Post) error {
+	if len(byID) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(byID))
+	for id, post := range byID {
+		post.Attachments = []Media{}
+		ids = append(ids, id)
+	}
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE post_id = ANY($1) ORDER BY post_id, position`
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return err
+		}
+		post := byID[*m.PostID]
+		post.Attachments = append(post.Attachments, m)
+	}
+	return rows.Err()
+}
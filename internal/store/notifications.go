@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Notification types.
+const (
+	NotificationMention       = "mention"
+	NotificationFollow        = "follow"
+	NotificationFollowRequest = "follow_request"
+	NotificationComment       = "comment"
+	NotificationReply         = "reply"
+	NotificationReaction      = "reaction"
+)
+
+// Event is something a user did that another user is notified about. Events
+// with the same GroupKey collapse into one unread notification, like "5 people
+// liked your post". An empty GroupKey never collapses.
+type Event struct {
+	Type      string
+	UserID    int64
+	ActorID   int64
+	PostID    *int64
+	CommentID *int64
+	GroupKey  string
+}
+
+// NotificationActor is one of the most recent users behind a notification.
+type NotificationActor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type Notification struct {
+	ID         int64               `json:"id"`
+	Type       string              `json:"type"`
+	Actors     []NotificationActor `json:"actors"`
+	ActorCount int                 `json:"actor_count"`
+	PostID     *int64              `json:"post_id,omitempty"`
+	CommentID  *int64              `json:"comment_id,omitempty"`
+	Read       bool                `json:"read"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+// notificationActors is how many of the latest actors are returned with a
+// notification, and maxNotificationActors how many are kept. An actor that
+// fell off the kept ones is counted again when they act once more.
+const (
+	notificationActors    = 3
+	maxNotificationActors = 50
+)
+
+// raise stores the notification of e inside tx. Events users cause themselves,
+// events between users blocking each other and events about posts the
+// recipient may not see are dropped.
+func raise(ctx context.Context, tx *sql.Tx, e Event) error {
+	query := `
+INSERT INTO notifications (user_id, actor_id, actor_ids, type, post_id, comment_id, group_key)
+SELECT $1::bigint, $2::bigint, ARRAY[$2::bigint], $3, $4::bigint, $5::bigint, NULLIF($6, '')
+WHERE $1::bigint <> $2::bigint
+AND NOT EXISTS (SELECT 1 FROM user_blocks WHERE ` + blockedBetween("$1::bigint", "$2::bigint") + `)
+AND ($4::bigint IS NULL OR EXISTS (SELECT 1 FROM posts p WHERE p.id = $4 AND ` + postVisibleTo("p", "$1::bigint") + `))
+ON CONFLICT (user_id, group_key) WHERE read_at IS NULL DO UPDATE SET
+    actor_count = notifications.actor_count + CASE WHEN EXCLUDED.actor_id = ANY(notifications.actor_ids) THEN 0 ELSE 1 END,
+    actor_ids = (ARRAY[EXCLUDED.actor_id] || array_remove(notifications.actor_ids, EXCLUDED.actor_id))[1:$7::int],
+    actor_id = EXCLUDED.actor_id,
+    updated_at = now()
+RETURNING id, actor_count, updated_at
+`
+	n := streamNotification{Type: e.Type, ActorID: e.ActorID, PostID: e.PostID, CommentID: e.CommentID}
+	err := tx.QueryRowContext(ctx, query, e.UserID, e.ActorID, e.Type, e.PostID, e.CommentID, e.GroupKey, maxNotificationActors).
+		Scan(&n.ID, &n.ActorCount, &n.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	return publish(ctx, tx, NotificationsTopic(e.UserID), StreamNotification, n)
+}
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// GetByUser returns a page of the notifications of the user, most recently
+// updated first by default, and the snapshot time to continue from. Events
+// collapsing into a notification move it to the top, the first page fixes the
+// snapshot and later pages leave out what was updated after it, so paging
+// neither skips nor repeats. Those show up on top when the list is read again.
+func (s *NotificationStore) GetByUser(ctx context.Context, userId int64, unreadOnly bool, fq PaginatedFeedQuery) ([]Notification, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := fmt.Sprintf(`
+SELECT n.id, n.type, n.actor_count, n.post_id, n.comment_id, n.read_at IS NOT NULL, n.created_at, n.updated_at,
+    ARRAY(SELECT u.id FROM unnest(n.actor_ids[1:%[1]d]) WITH ORDINALITY a(id, ord) JOIN users u ON u.id = a.id ORDER BY a.ord),
+    ARRAY(SELECT u.username FROM unnest(n.actor_ids[1:%[1]d]) WITH ORDINALITY a(id, ord) JOIN users u ON u.id = a.id ORDER BY a.ord),
+    snapshot.t
+FROM notifications n, (SELECT COALESCE($2::timestamptz, now()) AS t) snapshot
+WHERE n.user_id = $1 AND n.updated_at <= snapshot.t`, notificationActors)
+	if unreadOnly {
+		query += " AND n.read_at IS NULL"
+	}
+	var snapshot *time.Time
+	if fq.After != nil && !fq.After.Snapshot.IsZero() {
+		snapshot = &fq.After.Snapshot
+	}
+	args := []interface{}{userId, snapshot}
+	where, orderBy, keysetArgs := fq.keyset("n.updated_at", "n.id", len(args)+1)
+	if where != "" {
+		query += " AND " + where
+		args = append(args, keysetArgs...)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", orderBy, len(args)+1, len(args)+2)
+	args = append(args, fq.Limit, fq.Offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	var taken time.Time
+	for rows.Next() {
+		n := Notification{}
+		var ids pq.Int64Array
+		var usernames pq.StringArray
+		err := rows.Scan(&n.ID, &n.Type, &n.ActorCount, &n.PostID, &n.CommentID, &n.Read, &n.CreatedAt, &n.UpdatedAt, &ids, &usernames, &taken)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		n.Actors = make([]NotificationActor, len(ids))
+		for i := range ids {
+			n.Actors[i] = NotificationActor{ID: ids[i], Username: usernames[i]}
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
+	return notifications, taken, nil
+}
+
+// MarkRead marks the notifications of ids read, or all of them when ids is
+// empty. It returns how many were marked.
+func (s *NotificationStore) MarkRead(ctx context.Context, userId int64, ids []int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `UPDATE notifications SET read_at = now()
+	WHERE user_id = $1 AND read_at IS NULL AND (cardinality($2::bigint[]) = 0 OR id = ANY($2::bigint[]))`
+	result, err := s.db.ExecContext(ctx, query, userId, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *NotificationStore) CountUnread(ctx context.Context, userId int64) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userId).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+func raiseTest(t *testing.T, db *sql.DB, e Event) {
+	t.Helper()
+	ctx := context.Background()
+	if err := withTx(db, ctx, func(tx *sql.Tx) error { return raise(ctx, tx, e) }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotificationsCollapse(t *testing.T) {
+	db := newTestDB(t)
+	s := &NotificationStore{db: db}
+	ctx := context.Background()
+	owner := insertUser(t, db, "owner")
+	actors := make([]int64, maxNotificationActors+2)
+	for i := range actors {
+		actors[i] = insertUser(t, db, fmt.Sprintf("actor%d", i))
+	}
+
+	like := func(actor int64) Event {
+		return Event{Type: NotificationReaction, UserID: owner, ActorID: actor, GroupKey: "reaction:post:1"}
+	}
+	for _, actor := range actors {
+		raiseTest(t, db, like(actor))
+	}
+	// acting again moves the actor to the front without counting them twice
+	again := actors[len(actors)-5]
+	raiseTest(t, db, like(again))
+	// events users cause themselves are dropped
+	raiseTest(t, db, like(owner))
+	// an event without a group key never collapses
+	raiseTest(t, db, Event{Type: NotificationFollow, UserID: owner, ActorID: actors[0]})
+
+	all, _, err := s.GetByUser(ctx, owner, false, PaginatedFeedQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("got %d notifications, want the collapsed one and the follow", len(all))
+	}
+	var n Notification
+	for _, got := range all {
+		if got.Type == NotificationReaction {
+			n = got
+		}
+	}
+	if n.ActorCount != len(actors) {
+		t.Errorf("got actor count %d, want %d", n.ActorCount, len(actors))
+	}
+	want := []int64{again, actors[len(actors)-1], actors[len(actors)-2]}
+	if len(n.Actors) != notificationActors {
+		t.Fatalf("got %d actors, want %d", len(n.Actors), notificationActors)
+	}
+	for i, a := range n.Actors {
+		if a.ID != want[i] {
+			t.Errorf("actor %d: got %d, want %d", i, a.ID, want[i])
+		}
+	}
+
+	var kept int
+	if err := db.QueryRow(`SELECT cardinality(actor_ids) FROM notifications WHERE id = $1`, n.ID).Scan(&kept); err != nil {
+		t.Fatal(err)
+	}
+	if kept != maxNotificationActors {
+		t.Errorf("kept %d actors, want %d", kept, maxNotificationActors)
+	}
+
+	// once read, the next event starts a new notification
+	if _, err := s.MarkRead(ctx, owner, []int64{n.ID}); err != nil {
+		t.Fatal(err)
+	}
+	raiseTest(t, db, like(actors[2]))
+	if count, err := s.CountUnread(ctx, owner); err != nil || count != 2 {
+		t.Errorf("got %d unread, %v, want 2", count, err)
+	}
+}
+
+func TestNotificationsPagingWhileCollapsing(t *testing.T) {
+	db := newTestDB(t)
+	s := &NotificationStore{db: db}
+	ctx := context.Background()
+	owner := insertUser(t, db, "owner")
+	actor := insertUser(t, db, "actor")
+	other := insertUser(t, db, "other")
+	for i := range 6 {
+		raiseTest(t, db, Event{Type: NotificationReaction, UserID: owner, ActorID: actor, GroupKey: fmt.Sprintf("reaction:post:%d", i)})
+	}
+
+	fq := PaginatedFeedQuery{Limit: 3, Sort: "desc"}
+	first, snapshot, err := s.GetByUser(ctx, owner, false, fq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a notification of the second page collapses and moves to the top
+	raiseTest(t, db, Event{Type: NotificationReaction, UserID: owner, ActorID: other, GroupKey: "reaction:post:0"})
+
+	last := first[len(first)-1]
+	fq.After = &Cursor{CreatedAt: last.UpdatedAt, ID: last.ID, Snapshot: snapshot}
+	second, _, err := s.GetByUser(ctx, owner, false, fq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[int64]bool{}
+	for _, n := range append(first, second...) {
+		if seen[n.ID] {
+			t.Errorf("notification %d is on both pages", n.ID)
+		}
+		seen[n.ID] = true
+	}
+	if len(second) != 2 {
+		t.Errorf("got %d on the second page, want the 2 unchanged since the first", len(second))
+	}
+
+	// read again, the updated one is on top
+	top, _, err := s.GetByUser(ctx, owner, false, PaginatedFeedQuery{Limit: 1, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 1 || top[0].ActorCount != 2 {
+		t.Errorf("got %+v on top, want the collapsed notification", top)
+	}
+}
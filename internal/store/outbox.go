@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type OutboxMessage struct {
+	ID        int64           `json:"id" db:"id"`
+	Kind      string          `json:"kind" db:"kind"`
+	Payload   json.RawMessage `json:"payload" db:"payload"`
+	Attempts  int             `json:"attempts" db:"attempts"`
+	LastError string          `json:"last_error" db:"last_error"`
+	RunAt     time.Time       `json:"run_at" db:"run_at"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+type OutboxStore struct {
+	db *sql.DB
+}
+
+// enqueueOutbox stores msg inside tx, so the message is only ever delivered
+// when the surrounding transaction commits.
+func enqueueOutbox(ctx context.Context, tx *sql.Tx, msg *OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `INSERT INTO outbox (kind, payload) VALUES ($1, $2) RETURNING id, run_at, created_at`
+	return tx.QueryRowContext(ctx, query, msg.Kind, []byte(msg.Payload)).Scan(&msg.ID, &msg.RunAt, &msg.CreatedAt)
+}
+
+func (s *OutboxStore) Enqueue(ctx context.Context, msg *OutboxMessage) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return enqueueOutbox(ctx, tx, msg)
+	})
+}
+
+// Claim locks up to limit due messages for processing. Rows locked by another
+// worker are skipped, and rows stuck in processing for longer than lease are
+// picked up again, so a crashed worker does not lose messages.
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+UPDATE outbox SET status = 'processing', attempts = attempts + 1, locked_at = now(), updated_at = now()
+WHERE id IN (
+    SELECT id FROM outbox
+    WHERE (status = 'pending' AND run_at <= now())
+       OR (status = 'processing' AND locked_at < $2)
+    ORDER BY run_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, kind, payload, attempts, last_error, run_at, created_at
+`
+	rows, err := s.db.QueryContext(ctx, query, limit, time.Now().Add(-lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []OutboxMessage{}
+	for rows.Next() {
+		msg := OutboxMessage{}
+		var payload []byte
+		err := rows.Scan(&msg.ID, &msg.Kind, &payload, &msg.Attempts, &msg.LastError, &msg.RunAt, &msg.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		msg.Payload = payload
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (s *OutboxStore) Complete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = $1`, id)
+	return err
+}
+
+// Retry puts the message back to pending, to be claimed again at runAt.
+func (s *OutboxStore) Retry(ctx context.Context, id int64, lastErr string, runAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `UPDATE outbox SET status = 'pending', last_error = $2, run_at = $3, locked_at = NULL, updated_at = now() WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id, lastErr, runAt)
+	return err
+}
+
+// DeadLetter moves the message out of the outbox into outbox_dead_letters.
+func (s *OutboxStore) DeadLetter(ctx context.Context, id int64, lastErr string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+WITH moved AS (
+    DELETE FROM outbox WHERE id = $1
+    RETURNING id, kind, payload, attempts, created_at
+)
+INSERT INTO outbox_dead_letters (id, kind, payload, attempts, last_error, created_at)
+SELECT id, kind, payload, attempts, $2, created_at FROM moved
+`
+	_, err := s.db.ExecContext(ctx, query, id, lastErr)
+	return err
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func enqueue(t *testing.T, s *OutboxStore, n int) []int64 {
+	t.Helper()
+	var ids []int64
+	for range n {
+		msg := &OutboxMessage{Kind: "test", Payload: json.RawMessage(`{}`)}
+		if err := s.Enqueue(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+// TestOutboxClaimsEachMessageOnce claims from many workers at once, none of
+// which may get a message another one holds.
+func TestOutboxClaimsEachMessageOnce(t *testing.T) {
+	db := newTestDB(t)
+	s := &OutboxStore{db: db}
+	ids := enqueue(t, s, 60)
+
+	var mu sync.Mutex
+	claims := map[int64]int{}
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				messages, err := s.Claim(context.Background(), 7, time.Hour)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(messages) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, msg := range messages {
+					claims[msg.ID]++
+					if msg.Attempts != 1 {
+						t.Errorf("message %d claimed at attempt %d", msg.ID, msg.Attempts)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		if claims[id] != 1 {
+			t.Errorf("message %d claimed %d times", id, claims[id])
+		}
+	}
+}
+
+func TestOutboxClaim(t *testing.T) {
+	db := newTestDB(t)
+	s := &OutboxStore{db: db}
+	ctx := context.Background()
+	claim := func() []int64 {
+		t.Helper()
+		messages, err := s.Claim(ctx, 10, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, msg := range messages {
+			ids = append(ids, msg.ID)
+		}
+		return ids
+	}
+
+	ids := enqueue(t, s, 4)
+	due, later, crashed, failing := ids[0], ids[1], ids[2], ids[3]
+	mustExec(t, db, `UPDATE outbox SET run_at = now() + interval '1 hour' WHERE id = $1`, later)
+	if got := claim(); len(got) != 3 || slices.Contains(got, later) {
+		t.Fatalf("got %v, want the 3 due messages", got)
+	}
+	if got := claim(); len(got) != 0 {
+		t.Fatalf("claimed %v again", got)
+	}
+
+	// a worker that stopped past its lease loses the message
+	mustExec(t, db, `UPDATE outbox SET locked_at = now() - interval '2 hours' WHERE id = $1`, crashed)
+	messages, err := s.Claim(ctx, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].ID != crashed || messages[0].Attempts != 2 {
+		t.Fatalf("got %+v, want the message of the crashed worker at attempt 2", messages)
+	}
+
+	// a retry is claimed again once due, with its error
+	if err := s.Retry(ctx, failing, "failed", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	messages, err = s.Claim(ctx, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].ID != failing || messages[0].LastError != "failed" {
+		t.Fatalf("got %+v, want the retried message", messages)
+	}
+
+	if err := s.Complete(ctx, due); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeadLetter(ctx, failing, "failed again"); err != nil {
+		t.Fatal(err)
+	}
+	var left, dead int
+	if err := db.QueryRow(`SELECT count(*) FROM outbox`).Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT count(*) FROM outbox_dead_letters WHERE id = $1 AND last_error = 'failed again'`, failing).Scan(&dead); err != nil {
+		t.Fatal(err)
+	}
+	if left != 2 || dead != 1 {
+		t.Errorf("got %d messages left and %d dead letters, want the later and crashed ones left and one dead letter", left, dead)
+	}
+}
@@ -1,21 +1,56 @@
 package store
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var (
+	// CursorSecret signs the pagination cursors handed out to clients, so a
+	// cursor can not be forged or edited.
+	CursorSecret = []byte("change-me")
+
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
 type PaginatedFeedQuery struct {
 	Limit  int       `json:"limit" validate:"gte=1,lte=20"` // gte = greater than or equal
 	Page   int       `json:"page" validate:"gte=1"`         // optional
 	Offset int       `json:"offset"`
 	Sort   string    `json:"sort" validate:"oneof=asc desc"`
 	Tags   []string  `json:"tags" validate:"max=5"`
+	Match  string    `json:"match" validate:"oneof=any all"` // how Tags are matched
 	Search string    `json:"search" validate:"max=100"`
 	Since  time.Time `json:"since"`
 	Until  time.Time `json:"until"`
+	// After is set from the cursor query param. When present, results
+	// continue right after it and Page/Offset are ignored.
+	After *Cursor `json:"-"`
+}
+
+// Cursor is the keyset position of the last item of a page. Lists ordered by
+// a time that moves, like the updated_at of notifications, also carry the
+// time their first page was read at, later pages only hold items unchanged
+// since.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+	Snapshot  time.Time `json:"s,omitzero"`
+}
+
+// PaginatedResponse is the envelope of every paginated list. NextCursor is
+// empty on the last page.
+type PaginatedResponse[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor"`
 }
 
 func (fq *PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -39,6 +74,15 @@ func (fq *PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Page = p
 	}
 	fq.Offset = (fq.Page - 1) * fq.Limit
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			return *fq, err
+		}
+		fq.After = after
+		fq.Offset = 0
+	}
 	sort := qs.Get("sort")
 	if sort != "" {
 
@@ -48,6 +92,13 @@ func (fq *PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if tags != "" {
 
 		fq.Tags = strings.Split(tags, ",")
+		for i, tag := range fq.Tags {
+			fq.Tags[i] = strings.TrimSpace(tag)
+		}
+	}
+	match := qs.Get("match")
+	if match != "" {
+		fq.Match = match
 	}
 	search := qs.Get("search")
 
@@ -82,3 +133,73 @@ func (fq *PaginatedFeedQuery) ParseTime(timeStr string) (time.Time, error) {
 	t, err := time.Parse(layout, timeStr)
 	return t, err
 }
+
+// NewPaginatedResponse wraps a page of items, cursorOf gives the keyset
+// position of an item.
+func NewPaginatedResponse[T any](fq PaginatedFeedQuery, items []T, cursorOf func(T) Cursor) PaginatedResponse[T] {
+	res := PaginatedResponse[T]{Data: items}
+	if n := len(items); n > 0 {
+		res.NextCursor = fq.NextCursor(n, cursorOf(items[n-1]))
+	}
+	return res
+}
+
+// keyset returns the WHERE condition and ORDER BY clause that page through
+// createdAtCol/idCol in fq.Sort order, starting right after fq.After. Positional
+// parameters are numbered from next, and the arguments to append are returned.
+func (fq PaginatedFeedQuery) keyset(createdAtCol, idCol string, next int) (string, string, []any) {
+	sort := "DESC"
+	op := "<"
+	if fq.Sort == "asc" {
+		sort = "ASC"
+		op = ">"
+	}
+	orderBy := fmt.Sprintf("%s %s, %s %s", createdAtCol, sort, idCol, sort)
+	if fq.After == nil {
+		return "", orderBy, nil
+	}
+	where := fmt.Sprintf("(%s, %s) %s ($%d, $%d)", createdAtCol, idCol, op, next, next+1)
+	return where, orderBy, []any{fq.After.CreatedAt, fq.After.ID}
+}
+
+// NextCursor returns the cursor of the page that follows a page of n items
+// ending at last, or "" when the page was not full.
+func (fq PaginatedFeedQuery) NextCursor(n int, last Cursor) string {
+	if n < fq.Limit {
+		return ""
+	}
+	return last.Encode()
+}
+
+// Encode returns the opaque, signed form of the cursor.
+func (c Cursor) Encode() string {
+	payload, _ := json.Marshal(c)
+	mac := hmac.New(sha256.New, CursorSecret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	payloadPart, sigPart, ok := strings.Cut(s, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	mac := hmac.New(sha256.New, CursorSecret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidCursor
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(payload, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
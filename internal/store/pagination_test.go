@@ -0,0 +1,127 @@
+package store
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	at := time.Date(2026, 10, 18, 9, 30, 0, 123456000, time.UTC)
+	tests := []Cursor{
+		{CreatedAt: at, ID: 42},
+		{CreatedAt: at, ID: 42, Snapshot: at.Add(time.Minute)},
+	}
+	for _, c := range tests {
+		encoded := c.Encode()
+		got, err := DecodeCursor(encoded)
+		if err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if !got.CreatedAt.Equal(c.CreatedAt) || got.ID != c.ID || !got.Snapshot.Equal(c.Snapshot) {
+			t.Errorf("got %+v back, want %+v", got, c)
+		}
+	}
+	// cursors of lists without a snapshot stay as short as before
+	payload, _, _ := strings.Cut(Cursor{CreatedAt: at, ID: 1}.Encode(), ".")
+	if raw, _ := base64.RawURLEncoding.DecodeString(payload); strings.Contains(string(raw), `"s"`) {
+		t.Errorf("a cursor without a snapshot carries one: %s", raw)
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	valid := Cursor{CreatedAt: time.Unix(1_700_000_000, 0), ID: 7}.Encode()
+	payload, sig, _ := strings.Cut(valid, ".")
+	forged := Cursor{CreatedAt: time.Unix(1_700_000_000, 0), ID: 8}.Encode()
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	for _, s := range []string{
+		"",
+		payload,
+		payload + ".",
+		payload + "." + sig + "x",
+		forgedPayload + "." + sig,
+		"!!!." + sig,
+	} {
+		if _, err := DecodeCursor(s); err != ErrInvalidCursor {
+			t.Errorf("%q: got %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	after := &Cursor{CreatedAt: time.Unix(1_700_000_000, 0), ID: 7}
+	tests := []struct {
+		name      string
+		fq        PaginatedFeedQuery
+		where     string
+		orderBy   string
+		wantNArgs int
+	}{
+		{"first page", PaginatedFeedQuery{}, "", "t DESC, id DESC", 0},
+		{"descending", PaginatedFeedQuery{After: after}, "(t, id) < ($3, $4)", "t DESC, id DESC", 2},
+		{"ascending", PaginatedFeedQuery{Sort: "asc", After: after}, "(t, id) > ($3, $4)", "t ASC, id ASC", 2},
+	}
+	for _, tt := range tests {
+		where, orderBy, args := tt.fq.keyset("t", "id", 3)
+		if where != tt.where || orderBy != tt.orderBy || len(args) != tt.wantNArgs {
+			t.Errorf("%s: got %q, %q, %v", tt.name, where, orderBy, args)
+		}
+	}
+}
+
+func TestParsePaginatedQuery(t *testing.T) {
+	after := Cursor{CreatedAt: time.Unix(1_700_000_000, 0), ID: 7}
+	tests := []struct {
+		query   string
+		want    PaginatedFeedQuery
+		wantErr bool
+	}{
+		{"", PaginatedFeedQuery{Limit: 20, Page: 1}, false},
+		{"limit=5&page=3", PaginatedFeedQuery{Limit: 5, Page: 3, Offset: 10}, false},
+		{"page=3&cursor=" + after.Encode(), PaginatedFeedQuery{Limit: 20, Page: 3, After: &after}, false},
+		{"cursor=forged", PaginatedFeedQuery{}, true},
+		{"limit=x", PaginatedFeedQuery{}, true},
+		{"page=x", PaginatedFeedQuery{}, true},
+	}
+	for _, tt := range tests {
+		fq := PaginatedFeedQuery{Limit: 20, Page: 1}
+		got, err := fq.Parse(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: got error %v", tt.query, err)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		// a cursor overrides the page
+		if got.Limit != tt.want.Limit || got.Page != tt.want.Page || got.Offset != tt.want.Offset {
+			t.Errorf("%q: got limit %d, page %d, offset %d, want %+v", tt.query, got.Limit, got.Page, got.Offset, tt.want)
+		}
+		if (got.After == nil) != (tt.want.After == nil) || got.After != nil && got.After.ID != tt.want.After.ID {
+			t.Errorf("%q: got cursor %+v, want %+v", tt.query, got.After, tt.want.After)
+		}
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	fq := PaginatedFeedQuery{Limit: 2}
+	cursorOf := func(id int64) Cursor { return Cursor{ID: id} }
+	if res := NewPaginatedResponse(fq, []int64{}, cursorOf); res.NextCursor != "" {
+		t.Errorf("empty page: got cursor %q", res.NextCursor)
+	}
+	if res := NewPaginatedResponse(fq, []int64{5}, cursorOf); res.NextCursor != "" {
+		t.Errorf("last page: got cursor %q", res.NextCursor)
+	}
+	res := NewPaginatedResponse(fq, []int64{5, 4}, cursorOf)
+	next, err := DecodeCursor(res.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID != 4 {
+		t.Errorf("full page: got cursor %+v, want the last item", next)
+	}
+}
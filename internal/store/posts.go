@@ -11,60 +11,124 @@ import (
 )
 
 type Post struct {
-	ID        int64     `json:"id" db:"id"`
-	Content   string    `json:"content" db:"content"`
-	Title     string    `json:"title" db:"title"`
-	Tags      []string  `json:"tags" db:"tags"`
-	UserID    int64     `json:"user_id" db:"user_id"`
-	Comments  []Comment `json:"comments" db:"comments"`
-	User      User      `json:"Users" db:"Users"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID          int64     `json:"id" db:"id"`
+	Content     string    `json:"content" db:"content"`
+	Title       string    `json:"title" db:"title"`
+	Tags        []string  `json:"tags" db:"tags"`
+	UserID      int64     `json:"user_id" db:"user_id"`
+	Visibility  string    `json:"visibility" db:"visibility"`
+	Attachments []Media   `json:"attachments" db:"attachments"`
+	Comments    []Comment `json:"comments" db:"comments"`
+	User        User      `json:"Users" db:"Users"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+
+	// CommentsNextCursor pages through the comments beyond the embedded ones,
+	// through the comments endpoint of this post.
+	CommentsNextCursor string `json:"comments_next_cursor,omitempty" db:"-"`
 }
 
 type PostWithMetaData struct {
 	Post
-	CommentCount int `json:"comments_count"`
+	CommentCount   int            `json:"comments_count"`
+	ReactionCounts map[string]int `json:"reaction_counts"`
+	ViewerReacted  bool           `json:"viewer_reacted"`
 }
 
 type PostStore struct {
 	db *sql.DB
 }
 
-// @Summary		Create a new post
-// @Description	Creates a new post
-// @Tags			Posts
-// @Accept			json
-// @Produce		json
-// @Param			post	body		store.Post	true	"Post information"
-// @Success		201		{object}	store.Post
-// @Failure		400		{object}	error
-// @Failure		500		{object}	error
-// @Router			/posts [post]
+// Create inserts the post and attaches the uploads whose IDs are set in
+// post.Attachments, which are then replaced by the stored media. The hashtags
+// of the title and content are added to post.Tags.
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-	query := `INSERT INTO posts (content, title, tags, user_id) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`
-	err := s.db.QueryRowContext(ctx, query, post.Content, post.Title, pq.Array(post.Tags), post.UserID).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
-	if err != nil {
-		return err
+	if post.Visibility == "" {
+		post.Visibility = VisibilityPublic
 	}
-	return nil
+	text := post.Title + "\n" + post.Content
+	post.Tags = mergeTags(post.Tags, extractHashtags(text))
+	if post.Tags == nil {
+		post.Tags = []string{}
+	}
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		query := `INSERT INTO posts (content, title, tags, user_id, visibility) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at`
+		err := tx.QueryRowContext(ctx, query, post.Content, post.Title, pq.Array(post.Tags), post.UserID, post.Visibility).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if err := syncEntities(ctx, tx, postEntities, post.ID, post.ID, post.UserID, nil, text); err != nil {
+			return err
+		}
+		if len(post.Attachments) == 0 {
+			post.Attachments = []Media{}
+		} else {
+			ids := make([]int64, len(post.Attachments))
+			for i, m := range post.Attachments {
+				ids[i] = m.ID
+			}
+			if post.Attachments, err = attachMedia(ctx, tx, post.ID, post.UserID, ids); err != nil {
+				return err
+			}
+		}
+		// followers are streamed the posts they may see, but unlisted ones stay
+		// out of listings like the stream
+		if post.Visibility == VisibilityPrivate || post.Visibility == VisibilityUnlisted {
+			return nil
+		}
+		return publish(ctx, tx, PostsTopic(post.UserID), StreamPost, streamPost{
+			ID:         post.ID,
+			UserID:     post.UserID,
+			Title:      post.Title,
+			Visibility: post.Visibility,
+			CreatedAt:  post.CreatedAt,
+		})
+	})
 }
 
 // @Summary		Get all posts
-// @Description	Retrieves a list of all posts
+// @Description	Retrieves a page of posts, newest first by default
 // @Tags			Posts
 // @Produce		json
-// @Success		200	{array}		store.Post
-// @Failure		400	{object}	error
-// @Failure		500	{object}	error
+// @Param			limit	query		int		false	"Page size"
+// @Param			page	query		int		false	"Page number, ignored when cursor is set"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Param			sort	query		string	false	"asc or desc"
+// @Success		200		{object}	store.PaginatedResponse[store.Post]
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
 // @Router			/posts [get]
-func (s *PostStore) GetAll(ctx context.Context) ([]*Post, error) {
+func (s *PostStore) GetAll(ctx context.Context, viewerId int64, fq PaginatedFeedQuery) ([]*Post, error) {
+	query := `SELECT p.id, p.content, p.title, p.tags, p.user_id, p.visibility, p.created_at, p.updated_at FROM posts p WHERE ` + postListedTo("p", "$1")
+	return s.list(ctx, query, []interface{}{viewerId}, fq)
+}
+
+// GetByTag returns a page of the posts with the hashtag, newest first by
+// default.
+func (s *PostStore) GetByTag(ctx context.Context, tag string, viewerId int64, fq PaginatedFeedQuery) ([]*Post, error) {
+	query := `SELECT p.id, p.content, p.title, p.tags, p.user_id, p.visibility, p.created_at, p.updated_at
+	FROM post_hashtags ph
+	JOIN hashtags h ON h.id = ph.hashtag_id
+	JOIN posts p ON p.id = ph.post_id
+	WHERE h.name = $1 AND ` + postListedTo("p", "$2")
+	return s.list(ctx, query, []interface{}{strings.ToLower(tag), viewerId}, fq)
+}
+
+// list pages through the posts of query, which must select the post columns
+// of GetAll from posts aliased p.
+func (s *PostStore) list(ctx context.Context, query string, args []interface{}, fq PaginatedFeedQuery) ([]*Post, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	query := `SELECT id, content, title, tags, user_id, created_at, updated_at FROM posts ORDER BY created_at DESC`
-	rows, err := s.db.QueryContext(ctx, query)
+	where, orderBy, keysetArgs := fq.keyset("p.created_at", "p.id", len(args)+1)
+	if where != "" {
+		query += " AND " + where
+		args = append(args, keysetArgs...)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", orderBy, len(args)+1, len(args)+2)
+	args = append(args, fq.Limit, fq.Offset)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +137,7 @@ func (s *PostStore) GetAll(ctx context.Context) ([]*Post, error) {
 	posts := []*Post{}
 	for rows.Next() {
 		post := &Post{}
-		err := rows.Scan(&post.ID, &post.Content, &post.Title, pq.Array(&post.Tags), &post.UserID, &post.CreatedAt, &post.UpdatedAt)
+		err := rows.Scan(&post.ID, &post.Content, &post.Title, pq.Array(&post.Tags), &post.UserID, &post.Visibility, &post.CreatedAt, &post.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -82,6 +146,13 @@ func (s *PostStore) GetAll(ctx context.Context) ([]*Post, error) {
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
+	byID := make(map[int64]*Post, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+	if err := attachPostMedia(ctx, s.db, byID); err != nil {
+		return nil, err
+	}
 	return posts, nil
 }
 
@@ -95,21 +166,47 @@ func (s *PostStore) GetAll(ctx context.Context) ([]*Post, error) {
 // @Failure		404		{object}	error
 // @Failure		500		{object}	error
 // @Router			/posts/{postId} [get]
-func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
-	query := `SELECT id, content, title, tags, user_id, created_at, updated_at FROM posts WHERE id = $1`
+func (s *PostStore) GetByID(ctx context.Context, id int64, viewerId int64) (*Post, error) {
+	query := `SELECT p.id, p.content, p.title, p.tags, p.user_id, p.visibility, p.created_at, p.updated_at FROM posts p WHERE p.id = $1 AND ` + postVisibleTo("p", "$2")
 	post := &Post{}
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, id).Scan(&post.ID, &post.Content, &post.Title, pq.Array(&post.Tags), &post.UserID, &post.CreatedAt, &post.UpdatedAt)
+	err := s.db.QueryRowContext(ctx, query, id, viewerId).Scan(&post.ID, &post.Content, &post.Title, pq.Array(&post.Tags), &post.UserID, &post.Visibility, &post.CreatedAt, &post.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	if err := attachPostMedia(ctx, s.db, map[int64]*Post{post.ID: post}); err != nil {
+		return nil, err
+	}
 	return post, nil
 }
 
+// FilterViewers returns those of viewerIds that may see the post, in one query
+// for all of them.
+func (s *PostStore) FilterViewers(ctx context.Context, postID int64, viewerIds []int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT COALESCE(array_agg(v.id), '{}') FROM posts p, unnest($2::bigint[]) AS v(id)
+	WHERE p.id = $1 AND ` + postVisibleTo("p", "v.id")
+	var viewers pq.Int64Array
+	err := s.db.QueryRowContext(ctx, query, postID, pq.Array(viewerIds)).Scan(&viewers)
+	return viewers, err
+}
+
+// CanView reports whether the viewer may see the post. It answers GetByID for
+// posts that are already loaded, like cached ones.
+func (s *PostStore) CanView(ctx context.Context, postID int64, viewerId int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT EXISTS (SELECT 1 FROM posts p WHERE p.id = $1 AND ` + postVisibleTo("p", "$2") + `)`
+	var visible bool
+	err := s.db.QueryRowContext(ctx, query, postID, viewerId).Scan(&visible)
+	return visible, err
+}
+
 // @Summary		Delete a post by ID
 // @Description	Deletes a post by its ID
 // @Tags			Posts
@@ -156,8 +253,6 @@ func (s *PostStore) Update(ctx context.Context, postID int64, post *Post) error
 	setParts := []string{}
 	args := []interface{}{}
 	i := 1
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
 	if post.Title != "" {
 		setParts = append(setParts, fmt.Sprintf("title = $%d", i))
 		args = append(args, post.Title)
@@ -176,6 +271,12 @@ func (s *PostStore) Update(ctx context.Context, postID int64, post *Post) error
 		i++
 	}
 
+	if post.Visibility != "" {
+		setParts = append(setParts, fmt.Sprintf("visibility = $%d", i))
+		args = append(args, post.Visibility)
+		i++
+	}
+
 	if len(setParts) == 0 {
 		return fmt.Errorf("no fields to update")
 	}
@@ -186,24 +287,39 @@ func (s *PostStore) Update(ctx context.Context, postID int64, post *Post) error
 	i++
 
 	// Build final query
-	query := fmt.Sprintf("UPDATE posts SET %s WHERE id = $%d",
+	query := fmt.Sprintf("UPDATE posts SET %s WHERE id = $%d RETURNING user_id, title, content, tags",
 		strings.Join(setParts, ", "), i)
 	args = append(args, postID)
 
-	result, err := s.db.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		var userID int64
+		var title, content string
+		var tags []string
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&userID, &title, &content, pq.Array(&tags))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("no post found with id %d", postID)
+			}
+			return err
+		}
+		if post.Title == "" && post.Content == "" {
+			return nil
+		}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+		text := title + "\n" + content
+		if err := syncEntities(ctx, tx, postEntities, postID, postID, userID, nil, text); err != nil {
+			return err
+		}
+		merged := mergeTags(tags, extractHashtags(text))
+		if len(merged) == len(tags) {
+			return nil
+		}
+		post.Tags = merged
+		_, err = tx.ExecContext(ctx, `UPDATE posts SET tags = $2 WHERE id = $1`, postID, pq.Array(merged))
 		return err
-	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no post found with id %d", postID)
-	}
-
-	return nil
+	})
 }
 
 func (s *PostStore) GetUserFeed(ctx context.Context, userId int64, fq PaginatedFeedQuery) (*[]PostWithMetaData, error) {
@@ -214,33 +330,61 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userId int64, fq PaginatedF
 SELECT 
     p.id,
     p.user_id,
+    p.visibility,
     p.title,
     p.content,
     p.created_at,
     p.updated_at,
     p.tags,
     u.username,
-    COUNT(c.id) AS comments_count
+    COUNT(c.id) FILTER (WHERE c.deleted_at IS NULL) AS comments_count
 FROM posts p
 LEFT JOIN comments c ON c.post_id = p.id
 LEFT JOIN users u ON u.id = p.user_id
 WHERE (p.user_id = $1 OR p.user_id IN (
-    SELECT f.follower_id
+    SELECT f.user_id
     FROM followers f
-    WHERE f.user_id = $1
+    WHERE f.follower_id = $1
 ))
+AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = p.user_id)
+AND ` + postVisibleTo("p", "$1") + `
 `
 
 	args := []interface{}{userId}
 
 	// Add search filter only if search is provided
 	if fq.Search != "" {
-		query += " AND (p.title ILIKE '%' || $2 || '%' OR p.content ILIKE '%' || $2 || '%')"
 		args = append(args, fq.Search)
+		query += fmt.Sprintf(" AND (p.title ILIKE '%%' || $%d || '%%' OR p.content ILIKE '%%' || $%d || '%%')", len(args), len(args))
+	}
+
+	// && and @> can both use the GIN index on posts.tags
+	if len(fq.Tags) > 0 {
+		args = append(args, pq.Array(fq.Tags))
+		op := "&&"
+		if fq.Match == "all" {
+			op = "@>"
+		}
+		query += fmt.Sprintf(" AND p.tags %s $%d::varchar[]", op, len(args))
+	}
+
+	if !fq.Since.IsZero() {
+		args = append(args, fq.Since)
+		query += fmt.Sprintf(" AND p.created_at >= $%d", len(args))
+	}
+	if !fq.Until.IsZero() {
+		args = append(args, fq.Until)
+		query += fmt.Sprintf(" AND p.created_at <= $%d", len(args))
+	}
+
+	where, orderBy, keysetArgs := fq.keyset("p.created_at", "p.id", len(args)+1)
+	if where != "" {
+		query += " AND " + where
+		args = append(args, keysetArgs...)
 	}
 
-	query += fmt.Sprintf(" GROUP BY p.id, u.username ORDER BY p.created_at %s LIMIT $%d OFFSET $%d",
-		fq.Sort, len(args)+1, len(args)+2)
+	query += fmt.Sprintf(" GROUP BY p.id, u.username ORDER BY %s LIMIT $%d OFFSET $%d",
+		orderBy, len(args)+1, len(args)+2)
 
 	args = append(args, fq.Limit, fq.Offset)
 
@@ -256,6 +400,7 @@ WHERE (p.user_id = $1 OR p.user_id IN (
 		err := rows.Scan(
 			&post.ID,
 			&post.UserID,
+			&post.Visibility,
 			&post.Title,
 			&post.Content,
 			&post.CreatedAt,
@@ -274,5 +419,16 @@ WHERE (p.user_id = $1 OR p.user_id IN (
 		return nil, err
 	}
 
+	if err := attachPostReactions(ctx, s.db, posts, userId); err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*Post, len(posts))
+	for i := range posts {
+		byID[posts[i].ID] = &posts[i].Post
+	}
+	if err := attachPostMedia(ctx, s.db, byID); err != nil {
+		return nil, err
+	}
+
 	return &posts, nil
 }
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestGetUserFeedFilters(t *testing.T) {
+	db := newTestDB(t)
+	s := &PostStore{db: db}
+
+	viewer := insertUser(t, db, "viewer")
+	followed := insertUser(t, db, "followed")
+	stranger := insertUser(t, db, "stranger")
+	mustExec(t, db, `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`, followed, viewer)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hour := func(n int) time.Time { return base.Add(time.Duration(n) * time.Hour) }
+	posts := []struct {
+		name   string
+		author int64
+		tags   []string
+		at     time.Time
+	}{
+		{"own", viewer, []string{"go", "sql"}, hour(1)},
+		{"go", followed, []string{"go"}, hour(2)},
+		{"sql", followed, []string{"sql"}, hour(3)},
+		{"all", followed, []string{"go", "sql", "pg"}, hour(4)},
+		// not followed, never in the feed
+		{"stranger", stranger, []string{"go", "sql"}, hour(5)},
+	}
+	ids := map[string]int64{}
+	for _, p := range posts {
+		var id int64
+		err := db.QueryRow(`INSERT INTO posts (title, content, user_id, tags, created_at)
+		VALUES ($1, $1, $2, $3, $4) RETURNING id`, p.name, p.author, pq.Array(p.tags), p.at).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[p.name] = id
+	}
+
+	tests := []struct {
+		name  string
+		tags  []string
+		match string
+		since time.Time
+		until time.Time
+		sort  string
+		want  []string
+	}{
+		{name: "no filters", want: []string{"all", "sql", "go", "own"}},
+		{name: "ascending", sort: "asc", want: []string{"own", "go", "sql", "all"}},
+		{name: "one tag", tags: []string{"go"}, want: []string{"all", "go", "own"}},
+		{name: "any tag", tags: []string{"go", "pg"}, want: []string{"all", "go", "own"}},
+		{name: "all tags", tags: []string{"go", "sql"}, match: "all", want: []string{"all", "own"}},
+		{name: "all tags of one post", tags: []string{"go", "pg"}, match: "all", want: []string{"all"}},
+		{name: "no tag matches", tags: []string{"rust"}, want: []string{}},
+		{name: "since is inclusive", since: hour(2), want: []string{"all", "sql", "go"}},
+		{name: "until is inclusive", until: hour(3), want: []string{"sql", "go", "own"}},
+		{name: "since and until", since: hour(2), until: hour(3), want: []string{"sql", "go"}},
+		{name: "tags and since", tags: []string{"go"}, since: hour(2), want: []string{"all", "go"}},
+		{name: "all tags and until ascending", tags: []string{"sql"}, match: "all", until: hour(3), sort: "asc", want: []string{"own", "sql"}},
+	}
+
+	for _, tt := range tests {
+		fq := PaginatedFeedQuery{Sort: "desc", Match: "any", Tags: tt.tags, Since: tt.since, Until: tt.until}
+		if tt.match != "" {
+			fq.Match = tt.match
+		}
+		if tt.sort != "" {
+			fq.Sort = tt.sort
+		}
+		want := make([]int64, len(tt.want))
+		for i, name := range tt.want {
+			want[i] = ids[name]
+		}
+
+		// the whole feed on one page, then a post per page through the cursor
+		for _, limit := range []int{20, 1} {
+			fq.Limit = limit
+			got := feedPages(t, s, viewer, fq)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s, limit %d: got posts %v, want %v", tt.name, limit, got, want)
+			}
+		}
+	}
+}
+
+// feedPages reads the feed page by page, following the cursors like a client
+// does, and returns the IDs of the posts in order.
+func feedPages(t *testing.T, s *PostStore, userID int64, fq PaginatedFeedQuery) []int64 {
+	t.Helper()
+	ids := []int64{}
+	for range 100 {
+		feed, err := s.GetUserFeed(context.Background(), userID, fq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := NewPaginatedResponse(fq, *feed, func(p PostWithMetaData) Cursor {
+			return Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+		})
+		for _, p := range res.Data {
+			ids = append(ids, p.ID)
+		}
+		if res.NextCursor == "" {
+			return ids
+		}
+		if fq.After, err = DecodeCursor(res.NextCursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Fatal("the feed does not end")
+	return nil
+}
+
+// TestPostsKeysetPaging pages through posts that share creation times while a
+// new post arrives, which must neither repeat nor skip a post.
+func TestPostsKeysetPaging(t *testing.T) {
+	db := newTestDB(t)
+	s := &PostStore{db: db}
+	ctx := context.Background()
+
+	author := insertUser(t, db, "author")
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	insert := func(at time.Time) int64 {
+		t.Helper()
+		var id int64
+		err := db.QueryRow(`INSERT INTO posts (title, content, user_id, created_at)
+		VALUES ('t', 'c', $1, $2) RETURNING id`, author, at).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	// pairs of posts made at the same time, oldest first
+	var oldest []int64
+	for i := range 7 {
+		oldest = append(oldest, insert(base.Add(time.Duration(i/2)*time.Minute)))
+	}
+
+	// pageAll reads every page in sort order, and a new post arrives after the
+	// first one
+	pageAll := func(sort string) (ids []int64, arrived int64) {
+		t.Helper()
+		fq := PaginatedFeedQuery{Limit: 3, Sort: sort}
+		for {
+			posts, err := s.GetAll(ctx, author, fq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, post := range posts {
+				ids = append(ids, post.ID)
+			}
+			if arrived == 0 {
+				arrived = insert(base.Add(time.Hour))
+			}
+			if len(posts) == 0 {
+				return ids, arrived
+			}
+			last := posts[len(posts)-1]
+			next := fq.NextCursor(len(posts), Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+			if next == "" {
+				return ids, arrived
+			}
+			if fq.After, err = DecodeCursor(next); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// newest first, the new post is above the pages already read
+	got, arrived := pageAll("desc")
+	want := slices.Clone(oldest)
+	slices.Reverse(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("desc: got %v, want %v", got, want)
+	}
+	mustExec(t, db, `DELETE FROM posts WHERE id = $1`, arrived)
+
+	// oldest first, the pages reach the new post at the end
+	got, arrived = pageAll("asc")
+	if want := append(slices.Clone(oldest), arrived); !slices.Equal(got, want) {
+		t.Errorf("asc: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrReactionNotFound = errors.New("reaction not found")
+
+// Reaction targets either a post or a comment, never both.
+type Reaction struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	PostID    *int64    `json:"post_id,omitempty" db:"post_id"`
+	CommentID *int64    `json:"comment_id,omitempty" db:"comment_id"`
+	Type      string    `json:"type" db:"type"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Set creates the reaction of the user on the target, or changes its type when
+// the user already reacted. Only new reactions notify the author of the target.
+func (s *ReactionStore) Set(ctx context.Context, reaction *Reaction) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	conflict := "(post_id, user_id) WHERE post_id IS NOT NULL"
+	if reaction.CommentID != nil {
+		conflict = "(comment_id, user_id) WHERE comment_id IS NOT NULL"
+	}
+	query := `INSERT INTO reactions (user_id, post_id, comment_id, type) VALUES ($1, $2, $3, $4)
+	ON CONFLICT ` + conflict + ` DO UPDATE SET type = EXCLUDED.type, updated_at = now()
+	RETURNING id, created_at, updated_at, xmax = 0`
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var inserted bool
+		err := tx.QueryRowContext(ctx, query, reaction.UserID, reaction.PostID, reaction.CommentID, reaction.Type).
+			Scan(&reaction.ID, &reaction.CreatedAt, &reaction.UpdatedAt, &inserted)
+		if err != nil || !inserted {
+			return err
+		}
+
+		event := Event{Type: NotificationReaction, ActorID: reaction.UserID, CommentID: reaction.CommentID}
+		var postID int64
+		if reaction.CommentID != nil {
+			event.GroupKey = fmt.Sprintf("reaction:comment:%d", *reaction.CommentID)
+			query = `SELECT user_id, post_id FROM comments WHERE id = $1`
+			err = tx.QueryRowContext(ctx, query, *reaction.CommentID).Scan(&event.UserID, &postID)
+		} else {
+			event.GroupKey = fmt.Sprintf("reaction:post:%d", *reaction.PostID)
+			query = `SELECT user_id, id FROM posts WHERE id = $1`
+			err = tx.QueryRowContext(ctx, query, *reaction.PostID).Scan(&event.UserID, &postID)
+		}
+		if err != nil {
+			return err
+		}
+		event.PostID = &postID
+		return raise(ctx, tx, event)
+	})
+}
+
+func (s *ReactionStore) DeletePostReaction(ctx context.Context, postID, userID int64) error {
+	return s.delete(ctx, `DELETE FROM reactions WHERE post_id = $1 AND user_id = $2`, postID, userID)
+}
+
+func (s *ReactionStore) DeleteCommentReaction(ctx context.Context, commentID, userID int64) error {
+	return s.delete(ctx, `DELETE FROM reactions WHERE comment_id = $1 AND user_id = $2`, commentID, userID)
+}
+
+func (s *ReactionStore) delete(ctx context.Context, query string, targetID, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, query, targetID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrReactionNotFound
+	}
+	return nil
+}
+
+// attachPostReactions fills ReactionCounts and ViewerReacted of posts with a
+// single grouped query over the whole page.
+func attachPostReactions(ctx context.Context, db *sql.DB, posts []PostWithMetaData, viewerID int64) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(posts))
+	byID := make(map[int64]*PostWithMetaData, len(posts))
+	for i := range posts {
+		posts[i].ReactionCounts = map[string]int{}
+		ids[i] = posts[i].ID
+		byID[posts[i].ID] = &posts[i]
+	}
+
+	query := `
+SELECT post_id, type, COUNT(*), BOOL_OR(user_id = $2)
+FROM reactions
+WHERE post_id = ANY($1)
+GROUP BY post_id, type
+`
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids), viewerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var postID int64
+		var reactionType string
+		var count int
+		var viewerReacted bool
+		if err := rows.Scan(&postID, &reactionType, &count, &viewerReacted); err != nil {
+			return err
+		}
+		post := byID[postID]
+		post.ReactionCounts[reactionType] = count
+		post.ViewerReacted = post.ViewerReacted || viewerReacted
+	}
+	return rows.Err()
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestReactions(t *testing.T) {
+	db := newTestDB(t)
+	reactions := &ReactionStore{db: db}
+	posts := &PostStore{db: db}
+	ctx := context.Background()
+
+	author := insertUser(t, db, "author")
+	fan := insertUser(t, db, "fan")
+	critic := insertUser(t, db, "critic")
+	mustExec(t, db, `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`, author, fan)
+	var postID, commentID int64
+	if err := db.QueryRow(`INSERT INTO posts (title, content, user_id) VALUES ('t', 'c', $1) RETURNING id`, author).Scan(&postID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, 'c') RETURNING id`, postID, author).Scan(&commentID); err != nil {
+		t.Fatal(err)
+	}
+
+	set := func(user int64, reaction Reaction) {
+		t.Helper()
+		reaction.UserID = user
+		if err := reactions.Set(ctx, &reaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set(fan, Reaction{PostID: &postID, Type: "like"})
+	set(critic, Reaction{PostID: &postID, Type: "like"})
+	// reacting again changes the reaction, rather than adding one
+	set(critic, Reaction{PostID: &postID, Type: "angry"})
+	set(fan, Reaction{CommentID: &commentID, Type: "love"})
+
+	feed, err := posts.GetUserFeed(ctx, fan, PaginatedFeedQuery{Limit: 10, Sort: "desc", Match: "any"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*feed) != 1 {
+		t.Fatalf("got feed %+v, want the post", *feed)
+	}
+	post := (*feed)[0]
+	if want := map[string]int{"like": 1, "angry": 1}; !maps.Equal(post.ReactionCounts, want) || !post.ViewerReacted {
+		t.Errorf("got counts %v, viewer reacted %v, want %v by the viewer", post.ReactionCounts, post.ViewerReacted, want)
+	}
+
+	// the post collapses its reactions into one notification, the comment has its own
+	var notifications, actors int
+	err = db.QueryRow(`SELECT count(*), coalesce(sum(actor_count), 0) FROM notifications WHERE user_id = $1 AND type = $2`,
+		author, NotificationReaction).Scan(&notifications, &actors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notifications != 2 || actors != 3 {
+		t.Errorf("got %d notifications of %d actors, want 2 of 3", notifications, actors)
+	}
+
+	if err := reactions.DeletePostReaction(ctx, postID, critic); err != nil {
+		t.Fatal(err)
+	}
+	if err := reactions.DeletePostReaction(ctx, postID, critic); !errors.Is(err, ErrReactionNotFound) {
+		t.Errorf("deleting twice: got %v, want ErrReactionNotFound", err)
+	}
+	if err := reactions.DeleteCommentReaction(ctx, commentID, critic); !errors.Is(err, ErrReactionNotFound) {
+		t.Errorf("deleting a reaction of someone else: got %v, want ErrReactionNotFound", err)
+	}
+	if err := reactions.DeleteCommentReaction(ctx, commentID, fan); err != nil {
+		t.Fatal(err)
+	}
+	var left int
+	if err := db.QueryRow(`SELECT count(*) FROM reactions`).Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 1 {
+		t.Errorf("got %d reactions left, want the like of the fan", left)
+	}
+}
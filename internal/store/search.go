@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"strings"
+	"time"
+)
+
+type SearchResult struct {
+	Type   string `json:"type"`
+	ID     int64  `json:"id"`
+	PostID int64  `json:"post_id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	// Snippet is HTML, with the matches of posts and comments in <b></b>.
+	Snippet   string    `json:"snippet"`
+	Rank      float64   `json:"rank"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+// headlineOptions marks matches in snippets with <b></b>.
+const headlineOptions = "StartSel=<b>, StopSel=</b>, MaxFragments=2, MaxWords=30, MinWords=10"
+
+// htmlEscaped escapes the text of col for HTML. ts_headline runs on escaped
+// text, so the <b></b> around matches are the only markup of a snippet.
+func htmlEscaped(col string) string {
+	return "replace(replace(replace(" + col + ", '&', '&amp;'), '<', '&lt;'), '>', '&gt;')"
+}
+
+// SearchPosts ranks posts by their weighted title/content tsvector. Snippets
+// are only built for the rows of the requested page.
+func (s *SearchStore) SearchPosts(ctx context.Context, viewerId int64, fq PaginatedFeedQuery) ([]SearchResult, error) {
+	query := `
+WITH q AS (SELECT websearch_to_tsquery('english', $1) AS query),
+ranked AS (
+    SELECT p.id, ts_rank(p.search_vector, q.query) AS rank
+    FROM posts p, q
+    WHERE p.search_vector @@ q.query AND ` + postListedTo("p", "$5") + `
+    ORDER BY rank DESC, p.id DESC
+    LIMIT $2 OFFSET $3
+)
+SELECT p.id, p.title, ts_headline('english', ` + htmlEscaped("p.content") + `, q.query, $4), r.rank, p.user_id, u.username, p.created_at
+FROM ranked r
+JOIN posts p ON p.id = r.id
+JOIN users u ON u.id = p.user_id, q
+ORDER BY r.rank DESC, p.id DESC
+`
+	return s.search(ctx, "post", query, fq.Search, fq.Limit, fq.Offset, headlineOptions, viewerId)
+}
+
+// SearchComments only matches comments on the posts the viewer may list.
+func (s *SearchStore) SearchComments(ctx context.Context, viewerId int64, fq PaginatedFeedQuery) ([]SearchResult, error) {
+	query := `
+WITH q AS (SELECT websearch_to_tsquery('english', $1) AS query),
+ranked AS (
+    SELECT c.id, ts_rank(c.search_vector, q.query) AS rank
+    FROM comments c
+    JOIN posts p ON p.id = c.post_id, q
+    WHERE c.search_vector @@ q.query AND c.deleted_at IS NULL AND ` + postListedTo("p", "$5") + `
+    ORDER BY rank DESC, c.id DESC
+    LIMIT $2 OFFSET $3
+)
+SELECT c.id, c.post_id, ts_headline('english', ` + htmlEscaped("c.content") + `, q.query, $4), r.rank, c.user_id, u.username, c.created_at
+FROM ranked r
+JOIN comments c ON c.id = r.id
+JOIN users u ON u.id = c.user_id, q
+ORDER BY r.rank DESC, c.id DESC
+`
+	return s.search(ctx, "comment", query, fq.Search, fq.Limit, fq.Offset, headlineOptions, viewerId)
+}
+
+// likeEscaper escapes the LIKE metacharacters, so that % and _ in a search
+// match themselves.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers matches usernames by prefix or by trigram similarity, so typos
+// still find the user.
+func (s *SearchStore) SearchUsers(ctx context.Context, fq PaginatedFeedQuery) ([]SearchResult, error) {
+	query := `
+SELECT u.id, u.username, similarity(u.username, $1) AS rank, u.created_at
+FROM users u
+WHERE u.is_active AND (u.username % $1 OR u.username ILIKE $4 ESCAPE '\')
+ORDER BY rank DESC, u.id DESC
+LIMIT $2 OFFSET $3
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	prefix := likeEscaper.Replace(fq.Search) + "%"
+	rows, err := s.db.QueryContext(ctx, query, fq.Search, fq.Limit, fq.Offset, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		res := SearchResult{Type: "user"}
+		if err := rows.Scan(&res.ID, &res.Username, &res.Rank, &res.CreatedAt); err != nil {
+			return nil, err
+		}
+		res.UserID = res.ID
+		res.Snippet = html.EscapeString(res.Username)
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *SearchStore) search(ctx context.Context, kind, query string, args ...any) ([]SearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		res := SearchResult{Type: kind}
+		// the second column is the post title for posts and the post id for comments
+		dest := []any{&res.ID, &res.Title, &res.Snippet, &res.Rank, &res.UserID, &res.Username, &res.CreatedAt}
+		if kind == "comment" {
+			dest[1] = &res.PostID
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
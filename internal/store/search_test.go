@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLikeEscaper(t *testing.T) {
+	tests := map[string]string{
+		"alice":   "alice",
+		"50%":     `50\%`,
+		"a_b":     `a\_b`,
+		`back\%`:  `back\\\%`,
+		"%_%":     `\%\_\%`,
+		"ünïcode": "ünïcode",
+	}
+	for in, want := range tests {
+		if got := likeEscaper.Replace(in); got != want {
+			t.Errorf("likeEscaper.Replace(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	db := newTestDB(t)
+	s := &SearchStore{db: db}
+	ctx := context.Background()
+
+	author := insertUser(t, db, "author")
+	posts := map[string]int64{}
+	for name, content := range map[string]string{
+		"phrase":   "the quick brown fox",
+		"reversed": "a brown and quick fox",
+		"dog":      "the lazy dog",
+		"markup":   "a quick cat <b>bold</b> & <script>alert(1)</script>",
+	} {
+		var id int64
+		err := db.QueryRow(`INSERT INTO posts (title, content, user_id) VALUES ('post', $1, $2) RETURNING id`, content, author).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		posts[name] = id
+	}
+
+	search := func(q string) []SearchResult {
+		t.Helper()
+		results, err := s.SearchPosts(ctx, 0, PaginatedFeedQuery{Search: q, Limit: 10})
+		if err != nil {
+			t.Fatalf("%q: %v", q, err)
+		}
+		return results
+	}
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{`"quick brown"`, []string{"phrase"}},
+		{`quick brown`, []string{"phrase", "reversed"}},
+		{`cat or dog`, []string{"dog", "markup"}},
+		{`quick -fox`, []string{"markup"}},
+		{`"brown fox" or lazy`, []string{"phrase", "dog"}},
+	}
+	for _, tt := range tests {
+		var got []int64
+		for _, res := range search(tt.q) {
+			got = append(got, res.ID)
+		}
+		var want []int64
+		for _, name := range tt.want {
+			want = append(want, posts[name])
+		}
+		slices.Sort(got)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Errorf("%q: got posts %v, want %v", tt.q, got, want)
+		}
+	}
+
+	results := search("cat")
+	if len(results) != 1 {
+		t.Fatalf("got %+v, want the post with markup", results)
+	}
+	snippet := results[0].Snippet
+	if !strings.Contains(snippet, "<b>cat</b>") {
+		t.Errorf("snippet %q does not mark the match", snippet)
+	}
+	if strings.Count(snippet, "<") != strings.Count(snippet, "<b>cat</b>")*2 {
+		t.Errorf("snippet %q has markup of its own", snippet)
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	db := newTestDB(t)
+	s := &SearchStore{db: db}
+	ctx := context.Background()
+
+	for _, username := range []string{"alice", "abc", "a_c", "<i>eve"} {
+		insertUser(t, db, username)
+	}
+	search := func(q string) []string {
+		t.Helper()
+		results, err := s.SearchUsers(ctx, PaginatedFeedQuery{Search: q, Limit: 10})
+		if err != nil {
+			t.Fatalf("%q: %v", q, err)
+		}
+		var snippets []string
+		for _, res := range results {
+			snippets = append(snippets, res.Snippet)
+		}
+		slices.Sort(snippets)
+		return snippets
+	}
+
+	if got := search("ali"); !slices.Equal(got, []string{"alice"}) {
+		t.Errorf("prefix: got %v", got)
+	}
+	if got := search("%"); len(got) != 0 {
+		t.Errorf("%%: got %v, want no users", got)
+	}
+	if got := search("_"); len(got) != 0 {
+		t.Errorf("_: got %v, want no users", got)
+	}
+	if got := search("a_"); slices.Contains(got, "abc") || !slices.Contains(got, "a_c") {
+		t.Errorf("a_: got %v, want a_c and not abc", got)
+	}
+	if got := search("eve"); !slices.Equal(got, []string{"&lt;i&gt;eve"}) {
+		t.Errorf("escaping: got %v", got)
+	}
+}
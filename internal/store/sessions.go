@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found or expired")
+
+type Session struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	Token     string    `json:"-" db:"token"`
+	Expiry    time.Time `json:"expiry" db:"expiry"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+func (s *SessionStore) Create(ctx context.Context, session *Session) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `INSERT INTO user_sessions (user_id, token, expiry) VALUES ($1, $2, $3) RETURNING id, created_at`
+	err := s.db.QueryRowContext(ctx, query, session.UserID, session.Token, session.Expiry).Scan(&session.ID, &session.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rotate consumes the session identified by oldToken and stores session in its
+// place, so a refresh token can only ever be exchanged once.
+func (s *SessionStore) Rotate(ctx context.Context, oldToken string, session *Session) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		query := `DELETE FROM user_sessions WHERE token = $1 AND expiry > $2 RETURNING user_id`
+		err := tx.QueryRowContext(ctx, query, oldToken, time.Now()).Scan(&session.UserID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrSessionNotFound
+			}
+			return err
+		}
+		query = `INSERT INTO user_sessions (user_id, token, expiry) VALUES ($1, $2, $3) RETURNING id, created_at`
+		return tx.QueryRowContext(ctx, query, session.UserID, session.Token, session.Expiry).Scan(&session.ID, &session.CreatedAt)
+	})
+}
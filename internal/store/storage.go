@@ -8,8 +8,11 @@ import (
 
 type Posts interface {
 	Create(ctx context.Context, post *Post) error
-	GetAll(ctx context.Context) ([]*Post, error)
-	GetByID(ctx context.Context, id int64) (*Post, error)
+	GetAll(ctx context.Context, viewerId int64, fq PaginatedFeedQuery) ([]*Post, error)
+	GetByID(ctx context.Context, id int64, viewerId int64) (*Post, error)
+	CanView(ctx context.Context, postID int64, viewerId int64) (bool, error)
+	FilterViewers(ctx context.Context, postID int64, viewerIds []int64) ([]int64, error)
+	GetByTag(ctx context.Context, tag string, viewerId int64, fq PaginatedFeedQuery) ([]*Post, error)
 	Delete(ctx context.Context, postID int64) error
 	Update(ctx context.Context, postID int64, post *Post) error
 	GetUserFeed(ctx context.Context, userId int64, fq PaginatedFeedQuery) (*[]PostWithMetaData, error)
@@ -19,22 +22,96 @@ type Users interface {
 	GetUsers(ctx context.Context) (*[]User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	GetUserById(ctx context.Context, id int64) (*User, error)
-	CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error
+	CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration, invitation *OutboxMessage) error
 	Activate(ctx context.Context, token string, exp time.Duration) error
+	CreatePasswordReset(ctx context.Context, userId int64, token string, exp time.Duration, email *OutboxMessage) error
+	ResetPassword(ctx context.Context, token string, password *Password) error
+	SetPrivate(ctx context.Context, userId int64, private bool) ([]int64, error)
 }
 type Comments interface {
-	GetCommentsWithPost(ctx context.Context, postID int64) (*[]Comment, error)
+	GetCommentsWithPost(ctx context.Context, postID int64, fq PaginatedFeedQuery, opts ThreadOptions) (*[]Comment, error)
+	GetReplies(ctx context.Context, commentID int64, fq PaginatedFeedQuery, opts ThreadOptions) (*[]Comment, error)
 	CreateComment(ctx context.Context, comments *Comment) error
+	GetByID(ctx context.Context, id int64, viewerId int64) (*Comment, error)
+	GetByIDIncludingDeleted(ctx context.Context, id int64, viewerId int64) (*Comment, error)
+	Update(ctx context.Context, commentID int64, content string, editorID int64) (*Comment, error)
+	Delete(ctx context.Context, commentID int64) error
+	GetEdits(ctx context.Context, commentID int64) ([]CommentEdit, error)
+	GetByUser(ctx context.Context, userID int64, viewerId int64, fq PaginatedFeedQuery) (*[]Comment, error)
 }
 type Followers interface {
-	Follow(ctx context.Context, userId int64, followerId int64) error
+	Follow(ctx context.Context, userId int64, followerId int64) (bool, error)
 	UnFOllow(ctx context.Context, userId int64, unFOllowerId int64) error
+	GetRequests(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]FollowUser, error)
+	ApproveRequest(ctx context.Context, userId int64, requesterId int64) error
+	RejectRequest(ctx context.Context, userId int64, requesterId int64) error
+	GetFollowers(ctx context.Context, userId int64, viewerId int64, fq PaginatedFeedQuery) ([]FollowUser, error)
+	GetFollowing(ctx context.Context, userId int64, viewerId int64, fq PaginatedFeedQuery) ([]FollowUser, error)
+	GetCounts(ctx context.Context, userId int64) (*FollowCounts, error)
+	GetFollowedIDs(ctx context.Context, userId int64) ([]int64, error)
+	FilterFollowers(ctx context.Context, userId int64, ids []int64) ([]int64, error)
+	GetRelation(ctx context.Context, userId int64, viewerId int64) (Relation, error)
+}
+type Blocks interface {
+	Block(ctx context.Context, blockerId, blockedId int64) error
+	Unblock(ctx context.Context, blockerId, blockedId int64) error
+	Mute(ctx context.Context, muterId, mutedId int64) error
+	Unmute(ctx context.Context, muterId, mutedId int64) error
+	IsBlocked(ctx context.Context, userId, otherId int64) (bool, error)
+}
+type Uploads interface {
+	Create(ctx context.Context, media *Media, process *OutboxMessage) error
+	GetByKey(ctx context.Context, key string) (*Media, error)
+	SetProcessed(ctx context.Context, media *Media) error
+	SetFailed(ctx context.Context, mediaID int64) error
+}
+type Hashtags interface {
+	GetTrending(ctx context.Context, window time.Duration, limit int) ([]TrendingTag, error)
+}
+type Notifications interface {
+	GetByUser(ctx context.Context, userId int64, unreadOnly bool, fq PaginatedFeedQuery) ([]Notification, time.Time, error)
+	MarkRead(ctx context.Context, userId int64, ids []int64) (int64, error)
+	CountUnread(ctx context.Context, userId int64) (int, error)
+}
+type Sessions interface {
+	Create(ctx context.Context, session *Session) error
+	Rotate(ctx context.Context, oldToken string, session *Session) error
+}
+type Roles interface {
+	GetByName(ctx context.Context, name string) (*Role, error)
+}
+type Outbox interface {
+	Enqueue(ctx context.Context, msg *OutboxMessage) error
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	Complete(ctx context.Context, id int64) error
+	Retry(ctx context.Context, id int64, lastErr string, runAt time.Time) error
+	DeadLetter(ctx context.Context, id int64, lastErr string) error
+}
+type Search interface {
+	SearchPosts(ctx context.Context, viewerId int64, fq PaginatedFeedQuery) ([]SearchResult, error)
+	SearchComments(ctx context.Context, viewerId int64, fq PaginatedFeedQuery) ([]SearchResult, error)
+	SearchUsers(ctx context.Context, fq PaginatedFeedQuery) ([]SearchResult, error)
+}
+type Reactions interface {
+	Set(ctx context.Context, reaction *Reaction) error
+	DeletePostReaction(ctx context.Context, postID, userID int64) error
+	DeleteCommentReaction(ctx context.Context, commentID, userID int64) error
 }
 type Storage struct {
 	Posts     Posts
 	Users     Users
 	Comments  Comments
 	Followers Followers
+	Sessions  Sessions
+	Roles     Roles
+	Outbox    Outbox
+	Search    Search
+	Reactions Reactions
+	Blocks    Blocks
+	Uploads   Uploads
+	Hashtags  Hashtags
+
+	Notifications Notifications
 }
 
 var (
@@ -47,6 +124,16 @@ func NewStorage(db *sql.DB) *Storage {
 		Users:     &UserStore{db: db},
 		Comments:  &CommentStore{db: db},
 		Followers: &FollowerStore{db: db},
+		Sessions:  &SessionStore{db: db},
+		Roles:     &RoleStore{db: db},
+		Outbox:    &OutboxStore{db: db},
+		Search:    &SearchStore{db: db},
+		Reactions: &ReactionStore{db: db},
+		Blocks:    &BlockStore{db: db},
+		Uploads:   &MediaStore{db: db},
+		Hashtags:  &HashtagStore{db: db},
+
+		Notifications: &NotificationStore{db: db},
 	}
 }
 
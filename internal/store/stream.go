@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// StreamChannel is the Postgres channel stream events are sent on. Every API
+// instance listens on it and delivers the events to its own subscribers.
+const StreamChannel = "social_stream"
+
+// Types of stream events.
+const (
+	StreamNotification = "notification"
+	StreamPost         = "post"
+	StreamComment      = "comment"
+)
+
+// StreamEvent is delivered to the subscribers of its topic.
+type StreamEvent struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// NotificationsTopic carries the notifications of a user.
+func NotificationsTopic(userId int64) string {
+	return fmt.Sprintf("notifications:user:%d", userId)
+}
+
+// PostsTopic carries the new posts of an author to their followers.
+func PostsTopic(authorId int64) string {
+	return fmt.Sprintf("posts:user:%d", authorId)
+}
+
+// CommentsTopic carries the new comments on a post.
+func CommentsTopic(postId int64) string {
+	return fmt.Sprintf("comments:post:%d", postId)
+}
+
+type streamNotification struct {
+	ID         int64     `json:"id"`
+	Type       string    `json:"type"`
+	ActorID    int64     `json:"actor_id"`
+	ActorCount int       `json:"actor_count"`
+	PostID     *int64    `json:"post_id,omitempty"`
+	CommentID  *int64    `json:"comment_id,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// streamPost is the part of a new post sent to stream subscribers, the whole
+// content may not fit in a notification payload.
+type streamPost struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Title      string    `json:"title"`
+	Visibility string    `json:"visibility"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type streamComment struct {
+	ID        int64     `json:"id"`
+	PostID    int64     `json:"post_id"`
+	UserID    int64     `json:"user_id"`
+	ParentID  *int64    `json:"parent_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// publish sends the event inside tx. Postgres delivers it only once the
+// transaction commits, and not at all when it rolls back.
+func publish(ctx context.Context, tx *sql.Tx, topic, eventType string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(StreamEvent{Topic: topic, Type: eventType, Data: raw})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, StreamChannel, string(payload))
+	return err
+}
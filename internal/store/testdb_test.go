@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// newTestDB returns a database with the migrations applied, in a schema of its
+// own that is dropped when the test ends. The tests that need it are skipped
+// unless TEST_DB_ADDR points at a Postgres database.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR is not set")
+	}
+
+	admin, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("dropping test schema: %v", err)
+		}
+	})
+
+	// extensions already installed stay reachable through public
+	db, err := sql.Open("postgres", withSearchPath(addr, schema+",public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../../cmd/migrate/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+	for _, path := range migrations {
+		query, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(query)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	return db
+}
+
+// withSearchPath sets the search_path run-time parameter on a connection
+// string, in URL or key=value form.
+func withSearchPath(addr, searchPath string) string {
+	if u, err := url.Parse(addr); err == nil && strings.HasPrefix(u.Scheme, "postgres") {
+		q := u.Query()
+		q.Set("search_path", searchPath)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return addr + " search_path=" + searchPath
+}
+
+// mustExec runs a statement of the test setup.
+func mustExec(t *testing.T, db *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := db.ExecContext(context.Background(), query, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// insertUser creates an active user and returns its ID.
+func insertUser(t *testing.T, db *sql.DB, username string) int64 {
+	t.Helper()
+	var id int64
+	err := db.QueryRow(`INSERT INTO users (username, email, password, role_id, is_active)
+	VALUES ($1, $1 || '@example.com', 'x', (SELECT id FROM roles WHERE name = 'user'), true)
+	RETURNING id`, username).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
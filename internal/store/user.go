@@ -5,17 +5,24 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var ErrInvalidResetToken = errors.New("reset token is invalid or expired")
+
 type User struct {
 	ID        int64     `json:"id" db:"id"`
 	Username  string    `json:"username" db:"username"`
 	Email     string    `json:"email" db:"email"`
-	Password  Password  `json:"password" db:"password"`
+	Password  Password  `json:"-" db:"password"`
 	IsActive  bool      `json:"is_active" db:"is_active"`
+	IsPrivate bool      `json:"is_private" db:"is_private"`
+	RoleID    int64     `json:"role_id" db:"role_id"`
+	Role      Role      `json:"role" db:"role"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -38,13 +45,23 @@ func (p *Password) Set(text string) error {
 
 }
 
+func (p *Password) Compare(text string) error {
+	return bcrypt.CompareHashAndPassword(p.hash, []byte(text))
+}
+
 type UserStore struct {
 	db *sql.DB
 }
 
 func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
-	query := `INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at`
-	err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Password.hash).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	query := `INSERT INTO users (username, email, password, role_id)
+	VALUES ($1, $2, $3, (SELECT id FROM roles WHERE name = $4))
+	RETURNING id, role_id, created_at, updated_at`
+	role := user.Role.Name
+	if role == "" {
+		role = "user"
+	}
+	err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Password.hash, role).Scan(&user.ID, &user.RoleID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -86,11 +103,11 @@ func (s *UserStore) GetUsers(ctx context.Context) (*[]User, error) {
 func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	query := `SELECT id, username, email,  created_at, updated_at 
+	query := `SELECT id, username, email, password, is_active, created_at, updated_at 
 	          FROM users WHERE email = $1`
 	user := User{}
 
-	err := s.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.IsActive, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -102,21 +119,50 @@ func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, er
 func (s *UserStore) GetUserById(ctx context.Context, id int64) (*User, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	query := `SELECT id, username, email,  created_at, updated_at 
-	          FROM users WHERE id = $1`
+	query := `SELECT u.id, u.username, u.email, u.is_active, u.is_private, u.created_at, u.updated_at,
+	          r.id, r.name, r.level, r.description
+	          FROM users u JOIN roles r ON r.id = u.role_id WHERE u.id = $1`
 	user := User{}
 
-	err := s.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID, &user.Username, &user.Email, &user.IsActive, &user.IsPrivate, &user.CreatedAt, &user.UpdatedAt,
+		&user.Role.ID, &user.Role.Name, &user.Role.Level, &user.Role.Description,
+	)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	user.RoleID = user.Role.ID
 	return &user, nil
 }
 
-func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
+// SetPrivate changes whether the posts of the user are only shown to their
+// followers. Making the account public approves its pending follow requests,
+// the IDs of their senders are returned.
+func (s *UserStore) SetPrivate(ctx context.Context, userId int64, private bool) ([]int64, error) {
+	var approved []int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET is_private = $2, updated_at = now() WHERE id = $1`, userId, private); err != nil {
+			return err
+		}
+		if private {
+			return nil
+		}
+		query := `WITH approved AS (DELETE FROM follow_requests WHERE user_id = $1 RETURNING user_id, requester_id),
+		followed AS (INSERT INTO followers (user_id, follower_id) SELECT user_id, requester_id FROM approved ON CONFLICT DO NOTHING)
+		SELECT COALESCE(array_agg(requester_id), '{}') FROM approved`
+		return tx.QueryRowContext(ctx, query, userId).Scan((*pq.Int64Array)(&approved))
+	})
+	return approved, err
+}
+
+// CreateAndInvite creates the user and their invitation, and enqueues the
+// invitation email in the same transaction.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration, invitation *OutboxMessage) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		if err := s.Create(ctx, tx, user); err != nil {
 			return err
@@ -124,6 +170,9 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 		if err := s.createUserInvitation(ctx, tx, token, user.ID, invitationExp); err != nil {
 			return err
 		}
+		if err := enqueueOutbox(ctx, tx, invitation); err != nil {
+			return err
+		}
 		return nil
 	})
 
@@ -161,14 +210,14 @@ func (s *UserStore) Activate(ctx context.Context, token string, exp time.Duratio
 }
 
 func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string, exp time.Duration) (*User, error) {
-	query := `SELECT u.id,u.username,u.email,u.created_at,u.is_active FROM users u JOIN user_invitations ui on u.id=u.user_id
+	query := `SELECT u.id,u.username,u.email,u.created_at,u.is_active FROM users u JOIN user_invitations ui on u.id=ui.user_id
 	WHERE ui.token= $1 AND ui.expiry > $2`
 	hash := sha256.Sum256([]byte(token))
 	hashToken := hex.EncodeToString(hash[:])
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 	user := &User{}
-	err := tx.QueryRowContext(ctx, query, hashToken, user).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive)
+	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive)
 	if err != nil {
 		return nil, err
 	}
@@ -191,7 +240,7 @@ WHERE id = $4;
 }
 
 func (s *UserStore) deleteUserFromInvitation(ctx context.Context, tx *sql.Tx, userId int64) error {
-	query := `DELETE FROM users_invitations WHERE user_id = $1`
+	query := `DELETE FROM user_invitations WHERE user_id = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -202,3 +251,47 @@ func (s *UserStore) deleteUserFromInvitation(ctx context.Context, tx *sql.Tx, us
 	}
 	return nil
 }
+
+// CreatePasswordReset stores the hashed reset token and enqueues the reset
+// email in the same transaction.
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userId int64, token string, exp time.Duration, email *OutboxMessage) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		query := `INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3)`
+		if _, err := tx.ExecContext(ctx, query, token, userId, time.Now().Add(exp)); err != nil {
+			return err
+		}
+		return enqueueOutbox(ctx, tx, email)
+	})
+}
+
+// ResetPassword sets a new password for the owner of the token. The token and
+// any other reset token of the user are invalidated, and every session of the
+// user is revoked.
+func (s *UserStore) ResetPassword(ctx context.Context, token string, password *Password) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var userId int64
+		query := `DELETE FROM password_resets WHERE token = $1 AND expiry > $2 RETURNING user_id`
+		err := tx.QueryRowContext(ctx, query, token, time.Now()).Scan(&userId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2`, password.hash, userId); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = $1`, userId); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = $1`, userId); err != nil {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSetPrivateApprovesRequests(t *testing.T) {
+	db := newTestDB(t)
+	users := &UserStore{db: db}
+	ctx := context.Background()
+
+	owner := insertUser(t, db, "owner")
+	first := insertUser(t, db, "first")
+	second := insertUser(t, db, "second")
+	other := insertUser(t, db, "other")
+	mustExec(t, db, `UPDATE users SET is_private = true WHERE id = $1`, owner)
+	mustExec(t, db, `INSERT INTO follow_requests (user_id, requester_id) VALUES ($1, $2), ($1, $3), ($4, $2)`, owner, first, second, other)
+
+	approved, err := users.SetPrivate(ctx, owner, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(approved) != 0 {
+		t.Errorf("making the account private approved %v", approved)
+	}
+
+	approved, err = users.SetPrivate(ctx, owner, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(approved)
+	if want := []int64{first, second}; !slices.Equal(approved, want) {
+		t.Errorf("got approved %v, want %v", approved, want)
+	}
+	var followers, pending int
+	if err := db.QueryRow(`SELECT count(*) FROM followers WHERE user_id = $1`, owner).Scan(&followers); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT count(*) FROM follow_requests`).Scan(&pending); err != nil {
+		t.Fatal(err)
+	}
+	// the request to the other account stays
+	if followers != 2 || pending != 1 {
+		t.Errorf("got %d followers and %d pending requests, want 2 and 1", followers, pending)
+	}
+
+	approved, err = users.SetPrivate(ctx, owner, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(approved) != 0 {
+		t.Errorf("making the account public again approved %v", approved)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	db := newTestDB(t)
+	users := &UserStore{db: db}
+	sessions := &SessionStore{db: db}
+	ctx := context.Background()
+
+	id := insertUser(t, db, "forgetful")
+	other := insertUser(t, db, "other")
+	for _, user := range []int64{id, other} {
+		if err := sessions.Create(ctx, &Session{UserID: user, Token: fmt.Sprintf("session%d", user), Expiry: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reset := func(token string, exp time.Duration) {
+		t.Helper()
+		email := &OutboxMessage{Kind: "send_email", Payload: json.RawMessage(`{}`)}
+		if err := users.CreatePasswordReset(ctx, id, token, exp, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reset("expired", -time.Minute)
+	reset("first", time.Hour)
+	reset("second", time.Hour)
+
+	var password Password
+	if err := password.Set("new password"); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"expired", "unknown"} {
+		if err := users.ResetPassword(ctx, token, &password); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("token %s: got %v, want ErrInvalidResetToken", token, err)
+		}
+	}
+	if err := users.ResetPassword(ctx, "first", &password); err != nil {
+		t.Fatal(err)
+	}
+	// the token is single use, and resetting drops the other tokens too
+	for _, token := range []string{"first", "second"} {
+		if err := users.ResetPassword(ctx, token, &password); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("token %s after a reset: got %v, want ErrInvalidResetToken", token, err)
+		}
+	}
+
+	user, err := users.GetUserByEmail(ctx, "forgetful@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Password.Compare("new password") != nil {
+		t.Error("the password was not changed")
+	}
+	var emails, left int
+	if err := db.QueryRow(`SELECT count(*) FROM outbox`).Scan(&emails); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT count(*) FROM user_sessions WHERE user_id = $1`, other).Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if emails != 3 || left != 1 {
+		t.Errorf("got %d emails and %d sessions of the other user, want 3 and 1", emails, left)
+	}
+	if err := db.QueryRow(`SELECT count(*) FROM user_sessions WHERE user_id = $1`, id).Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("got %d sessions left after the reset, want none", left)
+	}
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPostNotVisible is returned when a user acts on a post they are not
+// allowed to see.
+var ErrPostNotVisible = errors.New("post is not visible to the user")
+
+// Visibility levels of a post. Unlisted posts are visible to anyone with the
+// link and in the feeds of followers, but left out of the post list and search.
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityPrivate   = "private"
+	VisibilityUnlisted  = "unlisted"
+)
+
+// postVisibleTo is the one authorization predicate for reading posts. It
+// returns a SQL condition that is true when the post aliased postAlias may be
+// seen by the viewer whose ID is in the viewerParam placeholder. Every query
+// that returns posts, or content attached to them, must apply it. An anonymous
+// viewer has ID 0.
+func postVisibleTo(postAlias, viewerParam string) string {
+	author := postAlias + ".user_id"
+	// nobody sees the posts of a user who blocks them, or of a user they block
+	notBlocked := fmt.Sprintf("NOT EXISTS (SELECT 1 FROM user_blocks WHERE %s)",
+		blockedBetween(author, viewerParam))
+	isFollower := fmt.Sprintf("EXISTS (SELECT 1 FROM followers WHERE user_id = %s AND follower_id = %s)",
+		author, viewerParam)
+	// the posts of private accounts are only shown to their approved followers
+	accountOpen := fmt.Sprintf("(NOT EXISTS (SELECT 1 FROM users WHERE id = %s AND is_private) OR %s)",
+		author, isFollower)
+	postOpen := fmt.Sprintf("(%[1]s.visibility IN ('%[2]s', '%[3]s') OR (%[1]s.visibility = '%[4]s' AND %[5]s))",
+		postAlias, VisibilityPublic, VisibilityUnlisted, VisibilityFollowers, isFollower)
+	// authors always see their own posts
+	return fmt.Sprintf("%s AND (%s = %s OR (%s AND %s))", notBlocked, author, viewerParam, accountOpen, postOpen)
+}
+
+// Relation is how a viewer stands to the author of a post.
+type Relation struct {
+	Blocked   bool `json:"blocked"`
+	Following bool `json:"following"`
+}
+
+// PostVisible is postVisibleTo for a post that is already loaded, given whether
+// its author is private and how the viewer stands to them. The two must be
+// kept in step.
+func PostVisible(post *Post, authorPrivate bool, viewerId int64, rel Relation) bool {
+	if rel.Blocked {
+		return false
+	}
+	if post.UserID == viewerId {
+		return true
+	}
+	accountOpen := !authorPrivate || rel.Following
+	postOpen := post.Visibility == VisibilityPublic || post.Visibility == VisibilityUnlisted ||
+		(post.Visibility == VisibilityFollowers && rel.Following)
+	return accountOpen && postOpen
+}
+
+// postListedTo is postVisibleTo for listings like the post list and search,
+// which leave out the unlisted posts of other users.
+func postListedTo(postAlias, viewerParam string) string {
+	return fmt.Sprintf("%s AND (%s.visibility <> '%s' OR %s.user_id = %s)",
+		postVisibleTo(postAlias, viewerParam), postAlias, VisibilityUnlisted, postAlias, viewerParam)
+}
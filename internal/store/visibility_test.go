@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// TestPostVisibleMatchesCanView checks PostVisible, which the cache decides
+// with, against postVisibleTo for every combination of its inputs.
+func TestPostVisibleMatchesCanView(t *testing.T) {
+	db := newTestDB(t)
+	s := &PostStore{db: db}
+	followers := &FollowerStore{db: db}
+	ctx := context.Background()
+
+	n := 0
+	for _, visibility := range []string{VisibilityPublic, VisibilityFollowers, VisibilityPrivate, VisibilityUnlisted} {
+		for _, private := range []bool{false, true} {
+			for _, following := range []bool{false, true} {
+				for _, blocked := range []bool{false, true} {
+					n++
+					author := insertUser(t, db, fmt.Sprintf("author%d", n))
+					viewer := insertUser(t, db, fmt.Sprintf("viewer%d", n))
+					mustExec(t, db, `UPDATE users SET is_private = $2 WHERE id = $1`, author, private)
+					if following {
+						mustExec(t, db, `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`, author, viewer)
+					}
+					if blocked {
+						mustExec(t, db, `INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)`, author, viewer)
+					}
+					post := &Post{UserID: author, Visibility: visibility}
+					err := db.QueryRow(`INSERT INTO posts (title, content, user_id, visibility)
+					VALUES ('t', 'c', $1, $2) RETURNING id`, author, visibility).Scan(&post.ID)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					rel, err := followers.GetRelation(ctx, author, viewer)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if rel.Following != following || rel.Blocked != blocked {
+						t.Errorf("GetRelation = %+v, want following %v blocked %v", rel, following, blocked)
+					}
+					for _, id := range []int64{viewer, author, 0} {
+						want, err := s.CanView(ctx, post.ID, id)
+						if err != nil {
+							t.Fatal(err)
+						}
+						r := rel
+						if id != viewer {
+							r = Relation{}
+						}
+						if got := PostVisible(post, private, id, r); got != want {
+							t.Errorf("%s post, private %v, following %v, blocked %v, viewer %d: PostVisible = %v, CanView = %v",
+								visibility, private, following, blocked, id, got, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPostVisible(t *testing.T) {
+	const author, viewer = 1, 2
+	tests := []struct {
+		visibility string
+		private    bool
+		rel        Relation
+		want       bool
+	}{
+		{VisibilityPublic, false, Relation{}, true},
+		{VisibilityUnlisted, false, Relation{}, true},
+		{VisibilityFollowers, false, Relation{}, false},
+		{VisibilityFollowers, false, Relation{Following: true}, true},
+		{VisibilityPrivate, false, Relation{Following: true}, false},
+		{VisibilityPublic, true, Relation{}, false},
+		{VisibilityPublic, true, Relation{Following: true}, true},
+		{VisibilityFollowers, true, Relation{Following: true}, true},
+		{VisibilityPublic, false, Relation{Blocked: true}, false},
+	}
+	for _, tt := range tests {
+		post := &Post{UserID: author, Visibility: tt.visibility}
+		if got := PostVisible(post, tt.private, viewer, tt.rel); got != tt.want {
+			t.Errorf("%s post, private %v, %+v: got %v, want %v", tt.visibility, tt.private, tt.rel, got, tt.want)
+		}
+		// authors see all their posts, unless blocked
+		if got := PostVisible(post, tt.private, author, tt.rel); got != !tt.rel.Blocked {
+			t.Errorf("%s post, private %v, %+v, seen by the author: got %v", tt.visibility, tt.private, tt.rel, got)
+		}
+	}
+}
+
+// TestPostLists checks unlisted posts are left out of the post list of other
+// users, and reach the feeds of followers like the posts for followers do.
+func TestPostLists(t *testing.T) {
+	db := newTestDB(t)
+	s := &PostStore{db: db}
+	ctx := context.Background()
+
+	author := insertUser(t, db, "author")
+	follower := insertUser(t, db, "follower")
+	stranger := insertUser(t, db, "stranger")
+	mustExec(t, db, `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`, author, follower)
+	ids := map[string]int64{}
+	for _, visibility := range []string{VisibilityPublic, VisibilityFollowers, VisibilityPrivate, VisibilityUnlisted} {
+		var id int64
+		err := db.QueryRow(`INSERT INTO posts (title, content, user_id, visibility) VALUES ('t', 'c', $1, $2) RETURNING id`,
+			author, visibility).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[visibility] = id
+	}
+	want := func(visibilities ...string) []int64 {
+		var want []int64
+		for _, v := range visibilities {
+			want = append(want, ids[v])
+		}
+		slices.Sort(want)
+		return want
+	}
+
+	listed := map[int64][]int64{
+		author:   want(VisibilityPublic, VisibilityFollowers, VisibilityPrivate, VisibilityUnlisted),
+		follower: want(VisibilityPublic, VisibilityFollowers),
+		stranger: want(VisibilityPublic),
+		0:        want(VisibilityPublic),
+	}
+	for viewer, want := range listed {
+		posts, err := s.GetAll(ctx, viewer, PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for _, post := range posts {
+			got = append(got, post.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("post list of viewer %d: got %v, want %v", viewer, got, want)
+		}
+	}
+
+	feed, err := s.GetUserFeed(ctx, follower, PaginatedFeedQuery{Limit: 10, Sort: "desc", Match: "any"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int64
+	for _, post := range *feed {
+		got = append(got, post.ID)
+	}
+	slices.Sort(got)
+	if want := want(VisibilityPublic, VisibilityFollowers, VisibilityUnlisted); !slices.Equal(got, want) {
+		t.Errorf("feed of the follower: got %v, want %v", got, want)
+	}
+
+	// the link of an unlisted post works for anyone
+	if post, err := s.GetByID(ctx, ids[VisibilityUnlisted], stranger); err != nil || post == nil {
+		t.Errorf("unlisted post by link: got %v, %v", post, err)
+	}
+}
@@ -0,0 +1,211 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// subscriptionBuffer is how many events may wait for a subscriber before new
+// ones are dropped for it.
+const subscriptionBuffer = 64
+
+// Authorizer returns those of userIDs that may receive ev. Topics are picked
+// when a stream starts, what a user may see can change while it is open. The
+// hub asks once per event for all of its subscribers.
+type Authorizer func(ctx context.Context, ev store.StreamEvent, userIDs []int64) ([]int64, error)
+
+// Hub fans stream events out to the subscribers of their topic in this
+// process. The events of every API instance reach it through Listen.
+type Hub struct {
+	mu        sync.RWMutex
+	topics    map[string]map[*Subscription]struct{}
+	authorize Authorizer
+	logger    *zap.SugaredLogger
+	// done is closed when the hub shuts down, wg counts the open
+	// subscriptions
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func NewHub(authorize Authorizer, logger *zap.SugaredLogger) *Hub {
+	return &Hub{topics: map[string]map[*Subscription]struct{}{}, authorize: authorize, logger: logger, done: make(chan struct{})}
+}
+
+// Subscription receives the events of its topics on C. A subscriber that does
+// not keep up misses events rather than holding up the others.
+type Subscription struct {
+	C         chan store.StreamEvent
+	hub       *Hub
+	userID    int64
+	topics    map[string]struct{}
+	closeOnce sync.Once
+}
+
+// Subscribe subscribes the user to topics.
+func (h *Hub) Subscribe(userID int64, topics ...string) *Subscription {
+	s := &Subscription{
+		C:      make(chan store.StreamEvent, subscriptionBuffer),
+		hub:    h,
+		userID: userID,
+		topics: map[string]struct{}{},
+	}
+	h.wg.Add(1)
+	s.Add(topics...)
+	return s
+}
+
+// Done is closed when the hub shuts down, the subscriber should then end its
+// stream and close the subscription.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.hub.done
+}
+
+func (s *Subscription) Add(topics ...string) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	for _, topic := range topics {
+		subs, ok := s.hub.topics[topic]
+		if !ok {
+			subs = map[*Subscription]struct{}{}
+			s.hub.topics[topic] = subs
+		}
+		subs[s] = struct{}{}
+		s.topics[topic] = struct{}{}
+	}
+}
+
+func (s *Subscription) Remove(topics ...string) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	for _, topic := range topics {
+		s.hub.unsubscribe(s, topic)
+	}
+}
+
+// Close removes the subscription from all its topics.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.hub.mu.Lock()
+		defer s.hub.mu.Unlock()
+		for topic := range s.topics {
+			s.hub.unsubscribe(s, topic)
+		}
+		s.hub.wg.Done()
+	})
+}
+
+// Close tells every subscriber to end its stream.
+func (h *Hub) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// Wait waits until every subscription is closed, or ctx is done.
+func (h *Hub) Wait(ctx context.Context) error {
+	closed := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("streams still open: %w", ctx.Err())
+	}
+}
+
+func (h *Hub) unsubscribe(s *Subscription, topic string) {
+	delete(s.topics, topic)
+	subs := h.topics[topic]
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+// Publish delivers ev to the subscribers of its topic in this process only,
+// events for all instances are published through the database. Events that
+// cannot be authorized are dropped.
+func (h *Hub) Publish(ctx context.Context, ev store.StreamEvent) {
+	h.mu.RLock()
+	subs := make([]*Subscription, 0, len(h.topics[ev.Topic]))
+	for s := range h.topics[ev.Topic] {
+		subs = append(subs, s)
+	}
+	h.mu.RUnlock()
+	if len(subs) == 0 {
+		return
+	}
+
+	seen := map[int64]bool{}
+	var userIDs []int64
+	for _, s := range subs {
+		if !seen[s.userID] {
+			seen[s.userID] = true
+			userIDs = append(userIDs, s.userID)
+		}
+	}
+	allowed, err := h.authorize(ctx, ev, userIDs)
+	if err != nil {
+		h.logger.Errorw("stream event not authorized, dropped", "topic", ev.Topic, "type", ev.Type, "error", err.Error())
+		return
+	}
+	recipients := make(map[int64]bool, len(allowed))
+	for _, id := range allowed {
+		recipients[id] = true
+	}
+	for _, s := range subs {
+		if !recipients[s.userID] {
+			continue
+		}
+		select {
+		case s.C <- ev:
+		default:
+			h.logger.Warnw("stream subscriber is behind, event dropped", "topic", ev.Topic, "type", ev.Type)
+		}
+	}
+}
+
+// Listen publishes the events sent on store.StreamChannel by any API instance
+// until ctx is done. dsn is the connection string of the database, the
+// listener holds a connection of its own.
+func (h *Hub) Listen(ctx context.Context, dsn string) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			h.logger.Warnw("stream listener", "event", event, "error", err.Error())
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(store.StreamChannel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// nil follows a reconnect, events sent in between are lost
+			if n == nil {
+				continue
+			}
+			var ev store.StreamEvent
+			if err := json.Unmarshal([]byte(n.Extra), &ev); err != nil {
+				h.logger.Warnw("invalid stream event", "error", err.Error())
+				continue
+			}
+			h.Publish(ctx, ev)
+		case <-time.After(90 * time.Second):
+			// check the connection, which is idle when nothing happens
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/likhon22/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// allowOnly is an Authorizer that lets only allowed receive events, and
+// records the user IDs of every call.
+func allowOnly(calls *[][]int64, allowed ...int64) Authorizer {
+	return func(ctx context.Context, ev store.StreamEvent, userIDs []int64) ([]int64, error) {
+		*calls = append(*calls, slices.Sorted(slices.Values(userIDs)))
+		var out []int64
+		for _, id := range userIDs {
+			if slices.Contains(allowed, id) {
+				out = append(out, id)
+			}
+		}
+		return out, nil
+	}
+}
+
+func received(s *Subscription) int {
+	n := 0
+	for {
+		select {
+		case <-s.C:
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	var calls [][]int64
+	h := NewHub(allowOnly(&calls, 1, 2), zap.NewNop().Sugar())
+	// user 1 has two streams open
+	a := h.Subscribe(1, "posts")
+	b := h.Subscribe(1, "posts")
+	c := h.Subscribe(2, "posts", "comments:7")
+	d := h.Subscribe(3, "posts")
+	e := h.Subscribe(4, "comments:8")
+
+	h.Publish(context.Background(), store.StreamEvent{Topic: "posts", Type: "post.created"})
+
+	if len(calls) != 1 || !slices.Equal(calls[0], []int64{1, 2, 3}) {
+		t.Fatalf("authorizer calls %v, want one with the distinct subscribers [1 2 3]", calls)
+	}
+	for _, tt := range []struct {
+		name string
+		sub  *Subscription
+		want int
+	}{
+		{"first stream of an allowed user", a, 1},
+		{"second stream of an allowed user", b, 1},
+		{"allowed user", c, 1},
+		{"refused user", d, 0},
+		{"other topic", e, 0},
+	} {
+		if got := received(tt.sub); got != tt.want {
+			t.Errorf("%s: received %d events, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPublishWithoutSubscribers(t *testing.T) {
+	var calls [][]int64
+	h := NewHub(allowOnly(&calls), zap.NewNop().Sugar())
+	s := h.Subscribe(1, "posts")
+	s.Close()
+	h.Publish(context.Background(), store.StreamEvent{Topic: "posts"})
+	if len(calls) != 0 {
+		t.Errorf("the authorizer was asked about %v without subscribers", calls)
+	}
+}
+
+func TestPublishAuthorizeError(t *testing.T) {
+	h := NewHub(func(ctx context.Context, ev store.StreamEvent, userIDs []int64) ([]int64, error) {
+		return userIDs, errors.New("database is down")
+	}, zap.NewNop().Sugar())
+	s := h.Subscribe(1, "posts")
+	h.Publish(context.Background(), store.StreamEvent{Topic: "posts"})
+	if got := received(s); got != 0 {
+		t.Errorf("received %d events that could not be authorized", got)
+	}
+}
+
+func TestSubscriptionTopics(t *testing.T) {
+	var calls [][]int64
+	h := NewHub(allowOnly(&calls, 1), zap.NewNop().Sugar())
+	s := h.Subscribe(1, "comments:1")
+	s.Add("comments:2")
+	s.Remove("comments:1")
+	h.Publish(context.Background(), store.StreamEvent{Topic: "comments:1"})
+	h.Publish(context.Background(), store.StreamEvent{Topic: "comments:2"})
+	if got := received(s); got != 1 {
+		t.Errorf("received %d events, want the one of the added topic", got)
+	}
+	s.Close()
+	if len(h.topics) != 0 {
+		t.Errorf("topics %v are left after closing", h.topics)
+	}
+}
@@ -0,0 +1,326 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoServer upgrades every request and sends the messages it reads back, an
+// error of ReadMessage is sent on errs.
+func echoServer(t *testing.T, origins []string) (*httptest.Server, chan error) {
+	t.Helper()
+	errs := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, origins)
+		if errors.Is(err, ErrBadOrigin) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			msg, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := conn.WriteText(msg); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, errs
+}
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dial opens a connection to srv and sends a handshake with header, it
+// returns the response to it.
+func dial(t *testing.T, srv *httptest.Server, header http.Header) (*client, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/stream", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{t: t, conn: conn, br: br}, res
+}
+
+// open dials srv and expects the handshake to succeed.
+func open(t *testing.T, srv *httptest.Server) *client {
+	t.Helper()
+	c, res := dial(t, srv, nil)
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got status %d, want 101", res.StatusCode)
+	}
+	return c
+}
+
+// send writes a frame as a client does, masked unless unmasked is set.
+func (c *client) send(fin bool, op byte, payload []byte, unmasked bool) {
+	c.t.Helper()
+	first := op
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	maskBit := byte(0x80)
+	if unmasked {
+		maskBit = 0
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	data := append([]byte(nil), payload...)
+	if !unmasked {
+		mask := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+		frame = append(frame, mask[:]...)
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+	if _, err := c.conn.Write(append(frame, data...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read reads a frame of the server, which must not be masked.
+func (c *client) read() (op byte, payload []byte) {
+	c.t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if header[0]&0x80 == 0 {
+		c.t.Fatal("the server fragmented a frame")
+	}
+	if header[1]&0x80 != 0 {
+		c.t.Fatal("the server masked a frame")
+	}
+	size := uint64(header[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+// expectClose reads a close frame with code.
+func (c *client) expectClose(code int) {
+	c.t.Helper()
+	op, payload := c.read()
+	if op != opClose {
+		c.t.Fatalf("got opcode %d, want a close frame", op)
+	}
+	if len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != code {
+		c.t.Fatalf("got close payload %q, want code %d", payload, code)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	srv, _ := echoServer(t, nil)
+	_, res := dial(t, srv, nil)
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got status %d, want 101", res.StatusCode)
+	}
+	// the example of RFC 6455 section 1.3
+	if got := res.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("got accept key %q", got)
+	}
+}
+
+func TestHandshakeRefused(t *testing.T) {
+	srv, _ := echoServer(t, nil)
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"old version", http.Header{"Sec-Websocket-Version": {"8"}}},
+		{"no key", http.Header{"Sec-Websocket-Key": {""}}},
+		{"no upgrade", http.Header{"Upgrade": {"h2c"}}},
+	}
+	for _, tt := range tests {
+		if _, res := dial(t, srv, tt.header); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want 400", tt.name, res.StatusCode)
+		}
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	srv, _ := echoServer(t, []string{"https://app.example.com/"})
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{"https://APP.example.com", http.StatusSwitchingProtocols},
+		// the API itself
+		{"http://" + srv.Listener.Addr().String(), http.StatusSwitchingProtocols},
+		{"https://evil.example.com", http.StatusForbidden},
+		{"http://app.example.com", http.StatusForbidden},
+		{"https://app.example.com.evil.com", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.origin != "" {
+			header.Set("Origin", tt.origin)
+		}
+		if _, res := dial(t, srv, header); res.StatusCode != tt.want {
+			t.Errorf("origin %q: got status %d, want %d", tt.origin, res.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	srv, _ := echoServer(t, nil)
+	c := open(t, srv)
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"short", "hello"},
+		{"empty", ""},
+		// lengths of 16 bits
+		{"medium", strings.Repeat("a", 126)},
+		{"largest", strings.Repeat("b", MaxMessageSize)},
+	}
+	for _, tt := range tests {
+		c.send(true, opText, []byte(tt.msg), false)
+		op, payload := c.read()
+		if op != opText || string(payload) != tt.msg {
+			t.Errorf("%s: got opcode %d and %d bytes back, want the message", tt.name, op, len(payload))
+		}
+	}
+}
+
+func TestFragmentation(t *testing.T) {
+	srv, _ := echoServer(t, nil)
+	c := open(t, srv)
+	c.send(false, opText, []byte("hel"), false)
+	// control frames may come between the fragments
+	c.send(true, opPing, []byte("p"), false)
+	c.send(false, opContinuation, []byte("lo "), false)
+	c.send(true, opContinuation, []byte("world"), false)
+
+	if op, payload := c.read(); op != opPong || string(payload) != "p" {
+		t.Fatalf("got opcode %d with %q, want the pong", op, payload)
+	}
+	if op, payload := c.read(); op != opText || string(payload) != "hello world" {
+		t.Fatalf("got opcode %d with %q, want the joined message", op, payload)
+	}
+}
+
+func TestPing(t *testing.T) {
+	srv, _ := echoServer(t, nil)
+	c := open(t, srv)
+	c.send(true, opPing, []byte("are you there"), false)
+	if op, payload := c.read(); op != opPong || string(payload) != "are you there" {
+		t.Fatalf("got opcode %d with %q, want a pong with the ping payload", op, payload)
+	}
+	// unsolicited pongs are ignored
+	c.send(true, opPong, nil, false)
+	c.send(true, opText, []byte("still open"), false)
+	if op, payload := c.read(); op != opText || string(payload) != "still open" {
+		t.Fatalf("got opcode %d with %q", op, payload)
+	}
+}
+
+func TestClose(t *testing.T) {
+	srv, errs := echoServer(t, nil)
+	c := open(t, srv)
+	c.send(true, opClose, binary.BigEndian.AppendUint16(nil, CloseGoingAway), false)
+	c.expectClose(CloseGoingAway)
+	if err := <-errs; err != io.EOF {
+		t.Errorf("ReadMessage returned %v, want io.EOF", err)
+	}
+	if _, err := c.br.ReadByte(); err != io.EOF {
+		t.Errorf("the connection is still open: %v", err)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(c *client)
+		code int
+	}{
+		{"unmasked", func(c *client) { c.send(true, opText, []byte("hi"), true) }, CloseProtocolError},
+		{"reserved bits", func(c *client) { c.send(true, 0x40|opText, []byte("hi"), false) }, CloseProtocolError},
+		{"unknown opcode", func(c *client) { c.send(true, 0x3, []byte("hi"), false) }, CloseProtocolError},
+		{"continuation first", func(c *client) { c.send(true, opContinuation, []byte("hi"), false) }, CloseProtocolError},
+		{"new message inside a fragmented one", func(c *client) {
+			c.send(false, opText, []byte("a"), false)
+			c.send(true, opText, []byte("b"), false)
+		}, CloseProtocolError},
+		{"fragmented control frame", func(c *client) { c.send(false, opPing, nil, false) }, CloseProtocolError},
+		{"long control frame", func(c *client) { c.send(true, opPing, make([]byte, 126), false) }, CloseProtocolError},
+		{"frame too big", func(c *client) { c.send(true, opText, make([]byte, MaxMessageSize+1), false) }, CloseTooBig},
+		{"fragments too big", func(c *client) {
+			c.send(false, opText, make([]byte, MaxMessageSize), false)
+			c.send(true, opContinuation, []byte("x"), false)
+		}, CloseTooBig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, errs := echoServer(t, nil)
+			c := open(t, srv)
+			tt.send(c)
+			c.expectClose(tt.code)
+			if err := <-errs; err == nil || err == io.EOF {
+				t.Errorf("ReadMessage returned %v, want a protocol error", err)
+			}
+		})
+	}
+}